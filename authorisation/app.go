@@ -0,0 +1,250 @@
+package authorisation
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brinick/github"
+	"github.com/brinick/logging"
+)
+
+// AppTokenRefreshMargin is how long before its expiry
+// an installation access token is renewed
+const AppTokenRefreshMargin = 5 * time.Minute
+
+var (
+	ErrInvalidPrivateKey = errors.New("Invalid Github App private key")
+	ErrNoInstallation    = errors.New("No Github App installation given")
+)
+
+// ------------------------------------------------------------------
+
+// AppToken is a TokenRetriever authenticating as an installation of a
+// Github App: it signs JWTs as the app to obtain installation access
+// tokens, which it caches until shortly before they expire.
+//
+// The installation is given by its ID or, failing that, looked up
+// from the organisation, user or repository ("owner/name") the app
+// is installed on.
+type AppToken struct {
+	AppID          int64
+	InstallationID int64
+	Org            string
+	User           string
+	Repo           string
+
+	// BaseURL is that of the Github API (default: the public one)
+	BaseURL    string
+	HTTPClient *http.Client
+
+	key          *rsa.PrivateKey
+	mu           sync.Mutex
+	installation int64 // looked up
+	token        string
+	expiresAt    time.Time
+}
+
+// NewAppToken creates an AppToken for the app with the given ID
+// and PEM encoded private key. The installation is to be set.
+func NewAppToken(appID int64, privateKey []byte) (*AppToken, error) {
+	key, err := parsePrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &AppToken{AppID: appID, key: key}, nil
+}
+
+// NewAppTokenFromFile creates an AppToken for the app with
+// the given ID and PEM encoded private key file
+func NewAppTokenFromFile(appID int64, path string) (*AppToken, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewAppToken(appID, data)
+}
+
+// parsePrivateKey parses a PKCS #1 (as generated by Github)
+// or PKCS #8 PEM encoded RSA private key
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPrivateKey
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPrivateKey, err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidPrivateKey
+	}
+	return rsaKey, nil
+}
+
+// JWT returns a new JSON Web Token authenticating as the app,
+// valid for 10 minutes
+func (a *AppToken) JWT() (string, error) {
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		// backdated, against clock drift
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(a.AppID, 10),
+	})
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// LoadToken fetches a new installation access token,
+// returning "" (and logging the error) if that fails
+func (a *AppToken) LoadToken() string {
+	a.mu.Lock()
+	a.expiresAt = time.Time{}
+	a.mu.Unlock()
+	return a.Token()
+}
+
+// Token returns the installation access token, renewed if
+// need be, or "" (logging the error) if that fails
+func (a *AppToken) Token() string {
+	token, err := a.TokenWithContext(context.TODO())
+	if err != nil {
+		logging.Error("Unable to get a Github App installation token", logging.F("err", err))
+	}
+	return token
+}
+
+// TokenWithContext returns the installation access token, renewed if need be
+func (a *AppToken) TokenWithContext(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token != "" && time.Until(a.expiresAt) > AppTokenRefreshMargin {
+		return a.token, nil
+	}
+
+	id, err := a.installationID(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	path := fmt.Sprintf("app/installations/%d/access_tokens", id)
+	if err := a.request(ctx, "POST", path, &result); err != nil {
+		return "", err
+	}
+
+	a.token, a.expiresAt = result.Token, result.ExpiresAt
+	return a.token, nil
+}
+
+// Identity identifies the app installation, whatever its current token
+func (a *AppToken) Identity() string {
+	switch {
+	case a.InstallationID != 0:
+		return fmt.Sprintf("app:%d:%d", a.AppID, a.InstallationID)
+	case a.Org != "":
+		return fmt.Sprintf("app:%d:org:%s", a.AppID, a.Org)
+	case a.User != "":
+		return fmt.Sprintf("app:%d:user:%s", a.AppID, a.User)
+	}
+	return fmt.Sprintf("app:%d:repo:%s", a.AppID, a.Repo)
+}
+
+// installationID returns the ID of the installation,
+// looking it up (once) if it was not given
+func (a *AppToken) installationID(ctx context.Context) (int64, error) {
+	if a.InstallationID != 0 {
+		return a.InstallationID, nil
+	}
+	if a.installation != 0 {
+		return a.installation, nil
+	}
+
+	var path string
+	switch {
+	case a.Org != "":
+		path = "orgs/" + a.Org + "/installation"
+	case a.User != "":
+		path = "users/" + a.User + "/installation"
+	case a.Repo != "":
+		path = "repos/" + a.Repo + "/installation"
+	default:
+		return 0, ErrNoInstallation
+	}
+
+	var result struct {
+		ID int64 `json:"id"`
+	}
+	if err := a.request(ctx, "GET", path, &result); err != nil {
+		return 0, err
+	}
+	a.installation = result.ID
+	return result.ID, nil
+}
+
+// request makes a request authenticated as the app, decoding the
+// JSON response into the value pointed to by result
+func (a *AppToken) request(ctx context.Context, method, path string, result interface{}) error {
+	jwt, err := a.JWT()
+	if err != nil {
+		return err
+	}
+
+	baseURL := a.BaseURL
+	if baseURL == "" {
+		baseURL = github.APIURLs.URL
+	}
+	url := strings.TrimRight(baseURL, "/") + "/" + path
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return ErrHTTPRequestFailure
+	}
+	req.Header.Set("Accept", github.APIURLs.STABLE)
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	c := a.HTTPClient
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s: %s", method, url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,101 @@
+package authorisation
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAppToken tests obtaining, caching and renewing installation
+// tokens, against a fake Github checking the app JWTs
+func TestAppToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	issued, lifetime := 0, time.Hour
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := checkJWT(r.Header.Get("Authorization"), &key.PublicKey, "42"); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /orgs/octo/installation":
+			fmt.Fprint(w, `{"id": 7}`)
+		case "POST /app/installations/7/access_tokens":
+			issued++
+			fmt.Fprintf(w, `{"token": "t%d", "expires_at": %q}`,
+				issued, time.Now().Add(lifetime).Format(time.RFC3339))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	app, err := NewAppToken(42, pemKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Org, app.BaseURL = "octo", srv.URL
+
+	if token := app.Token(); token != "t1" || app.installation != 7 {
+		t.Fatalf("Expected token t1 of installation 7, got %q (%d)", token, app.installation)
+	}
+	if token := app.Token(); token != "t1" {
+		t.Errorf("Expected the cached token, got %q", token)
+	}
+
+	lifetime = time.Minute
+	if token := app.LoadToken(); token != "t2" {
+		t.Errorf("Expected a new token, got %q", token)
+	}
+	if token := app.Token(); token != "t3" {
+		t.Errorf("Expected the token about to expire to be renewed, got %q", token)
+	}
+
+	if _, err := NewAppToken(42, []byte("nope")); err == nil {
+		t.Errorf("Expected an invalid key error")
+	}
+}
+
+// checkJWT checks the "Bearer <JWT>" authorization signed by the app
+func checkJWT(auth string, key *rsa.PublicKey, appID string) error {
+	parts := strings.Split(strings.TrimPrefix(auth, "Bearer "), ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("Malformed JWT: %s", auth)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return err
+	}
+
+	var claims struct {
+		Iss string `json:"iss"`
+		Exp int64  `json:"exp"`
+	}
+	data, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return err
+	}
+	if claims.Iss != appID || claims.Exp < time.Now().Unix() {
+		return fmt.Errorf("Invalid claims: %+v", claims)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package authorisation
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brinick/logging"
+)
+
+// DefaultPoolWait is how long a TokenPool whose tokens are all exhausted
+// waits before trying again, when their reset times are unknown
+const DefaultPoolWait = time.Minute
+
+// minExhaustion is the least time a rate limited token is considered
+// exhausted, whatever its reported reset time (which may have already
+// passed, if the clocks are out of sync)
+const minExhaustion = time.Second
+
+var ErrEmptyPool = errors.New("No tokens in the pool")
+
+// ------------------------------------------------------------------
+
+// TokenPool is a TokenRetriever handing out, of several tokens, the one
+// with the most API calls remaining, as observed by the client using the
+// pool (see RateObserver). Tokens are assumed to give access to the
+// same resources. If all tokens are exhausted, getting a token waits
+// until the quota of one of them is reset.
+type TokenPool struct {
+	mu     sync.Mutex
+	tokens []*pooledToken
+}
+
+type pooledToken struct {
+	value string
+	calls APICalls // Remaining is -1 until known
+}
+
+// NewTokenPool creates a pool of the given tokens
+func NewTokenPool(tokens ...string) *TokenPool {
+	p := &TokenPool{}
+	for _, token := range tokens {
+		if token = strings.TrimSpace(token); token != "" {
+			p.tokens = append(p.tokens, &pooledToken{value: token, calls: APICalls{Remaining: -1, Limit: -1}})
+		}
+	}
+	return p
+}
+
+// LoadToken returns the token with the most API calls remaining,
+// or "" (logging the error) if there is none
+func (p *TokenPool) LoadToken() string {
+	return p.Token()
+}
+
+// Token returns the token with the most API calls remaining,
+// or "" (logging the error) if there is none
+func (p *TokenPool) Token() string {
+	token, err := p.TokenWithContext(context.TODO())
+	if err != nil {
+		logging.Error("Unable to get a token from the pool", logging.F("err", err))
+	}
+	return token
+}
+
+// TokenWithContext returns the token with the most API calls remaining,
+// waiting (until the context is done) if they are all exhausted
+func (p *TokenPool) TokenWithContext(ctx context.Context) (string, error) {
+	for {
+		p.mu.Lock()
+		if len(p.tokens) == 0 {
+			p.mu.Unlock()
+			return "", ErrEmptyPool
+		}
+		best, wait := p.best(time.Now(), "")
+		if best != nil {
+			p.mu.Unlock()
+			return best.value, nil
+		}
+		p.mu.Unlock()
+
+		logging.Info("All tokens of the pool are exhausted, waiting", logging.F("wait", wait))
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return "", ctx.Err()
+		}
+	}
+}
+
+// Rotate returns another token than the rate limited one, if one has
+// API calls remaining. The rate limited token is considered exhausted
+// until its reset time, and for at least minExhaustion.
+func (p *TokenPool) Rotate(limited string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for _, t := range p.tokens {
+		if t.value == limited {
+			t.calls.Remaining = 0
+			if until := now.Add(minExhaustion); t.calls.Reset.Before(until) {
+				t.calls.Reset = until
+			}
+		}
+	}
+	if best, _ := p.best(now, limited); best != nil {
+		return best.value, true
+	}
+	return "", false
+}
+
+// ObserveRate records the API calls remaining for one of the tokens
+func (p *TokenPool) ObserveRate(token string, calls APICalls) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, t := range p.tokens {
+		if t.value != token {
+			continue
+		}
+		// responses may be observed out of order
+		if t.calls.Remaining < 0 || calls.Reset.After(t.calls.Reset) || calls.Remaining < t.calls.Remaining {
+			t.calls = calls
+		}
+	}
+}
+
+// Remaining returns the API calls remaining for each token of the
+// pool, in order, with Remaining set to -1 for those not yet used
+func (p *TokenPool) Remaining() []APICalls {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	calls := make([]APICalls, len(p.tokens))
+	for i, t := range p.tokens {
+		calls[i] = t.calls
+	}
+	return calls
+}
+
+// Identity identifies the pool, whatever the token in use
+func (p *TokenPool) Identity() string {
+	h := sha256.New()
+	for _, t := range p.tokens {
+		fmt.Fprintln(h, t.value)
+	}
+	return fmt.Sprintf("pool:%x", h.Sum(nil))
+}
+
+// best returns the token (other than the excluded one) with the most
+// API calls remaining, reserving one of them. If all are exhausted,
+// it returns nil and how long to wait until one of them is reset.
+func (p *TokenPool) best(now time.Time, exclude string) (*pooledToken, time.Duration) {
+	var (
+		best      *pooledToken
+		bestCalls = 0
+		wait      = time.Duration(math.MaxInt64)
+	)
+	for _, t := range p.tokens {
+		if t.value == exclude {
+			continue
+		}
+
+		remaining := t.calls.Remaining
+		switch {
+		case remaining < 0 || (!t.calls.Reset.IsZero() && !now.Before(t.calls.Reset)):
+			// unknown, or reset since
+			remaining = math.MaxInt
+		case remaining == 0:
+			if t.calls.Reset.IsZero() {
+				wait = min(wait, DefaultPoolWait)
+			} else {
+				wait = min(wait, t.calls.Reset.Sub(now))
+			}
+		}
+		if remaining > bestCalls {
+			best, bestCalls = t, remaining
+		}
+	}
+
+	if best != nil && best.calls.Remaining > 0 {
+		best.calls.Remaining--
+	}
+	return best, wait
+}
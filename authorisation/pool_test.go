@@ -0,0 +1,67 @@
+package authorisation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestTokenPool tests handing out the tokens with the
+// most calls remaining, and waiting once all are exhausted
+func TestTokenPool(t *testing.T) {
+	pool := NewTokenPool("a", "b", "c")
+	now := time.Now()
+	pool.ObserveRate("a", APICalls{Remaining: 10, Limit: 5000, Reset: now.Add(time.Hour)})
+	pool.ObserveRate("b", APICalls{Remaining: 12, Limit: 5000, Reset: now.Add(time.Hour)})
+	if token := pool.Token(); token != "c" {
+		t.Errorf("Expected the token not used yet, got %q", token)
+	}
+
+	pool.ObserveRate("c", APICalls{Remaining: 11, Limit: 5000, Reset: now.Add(time.Hour)})
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, pool.Token())
+	}
+	if got[0] != "b" || got[1] != "b" || got[2] == "a" {
+		t.Errorf("Expected tokens by remaining calls, got %v", got)
+	}
+
+	if token, ok := pool.Rotate("b"); !ok || token == "b" {
+		t.Errorf("Expected another token than b, got %q", token)
+	}
+
+	for _, token := range []string{"a", "b", "c"} {
+		pool.ObserveRate(token, APICalls{Remaining: 0, Limit: 5000, Reset: now.Add(time.Hour)})
+	}
+	if _, ok := pool.Rotate("a"); ok {
+		t.Errorf("Expected no token to rotate to")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := pool.TokenWithContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected to wait until the context is done, got %v", err)
+	}
+
+	// reset times already passed, as with clock skew
+	pool = NewTokenPool("a", "b")
+	for _, token := range []string{"a", "b"} {
+		pool.ObserveRate(token, APICalls{Remaining: 0, Limit: 5000, Reset: now.Add(-time.Minute)})
+	}
+	if token, ok := pool.Rotate("a"); !ok || token != "b" {
+		t.Errorf("Expected to rotate to b, got %q", token)
+	}
+	if token, ok := pool.Rotate("b"); ok {
+		t.Errorf("Expected a to stay exhausted after its rotation, got %q", token)
+	}
+
+	pool = NewTokenPool("c")
+	pool.ObserveRate("c", APICalls{Remaining: 0, Limit: 5000, Reset: time.Now().Add(50 * time.Millisecond)})
+	if token, err := pool.TokenWithContext(context.Background()); token != "c" || err != nil {
+		t.Errorf("Expected c once reset, got %q (err: %v)", token, err)
+	}
+
+	if _, err := NewTokenPool().TokenWithContext(context.Background()); err != ErrEmptyPool {
+		t.Errorf("Expected ErrEmptyPool, got %v", err)
+	}
+}
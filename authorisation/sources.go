@@ -0,0 +1,336 @@
+package authorisation
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/brinick/logging"
+)
+
+// ErrNoToken is returned when no token could be found for a host
+var ErrNoToken = errors.New("No Github token found")
+
+// ------------------------------------------------------------------
+
+// TokenSource is a source of tokens for Github hosts ("github.com"
+// or a Github Enterprise Server host). It returns ErrNoToken if it
+// has none for the given host.
+type TokenSource interface {
+	TokenFor(ctx context.Context, host string) (string, error)
+}
+
+// HostOf returns the host of the Github API with the given URL,
+// i.e. github.com for the public API
+func HostOf(apiURL string) string {
+	u, err := url.Parse(apiURL)
+	if err != nil || u.Host == "" {
+		return apiURL
+	}
+	if host := u.Hostname(); host != "api.github.com" {
+		return host
+	}
+	return "github.com"
+}
+
+// ------------------------------------------------------------------
+
+// StaticToken is a token given explicitly, for any host
+type StaticToken string
+
+func (s StaticToken) LoadToken() string { return string(s) }
+func (s StaticToken) Token() string     { return string(s) }
+
+func (s StaticToken) TokenFor(ctx context.Context, host string) (string, error) {
+	return nonEmpty(string(s))
+}
+
+// EnvToken reads the token from the first of the env vars set. Without
+// vars, these are GITHUB_TOKEN and GH_TOKEN for github.com, and
+// GH_ENTERPRISE_TOKEN and GITHUB_TOKEN for other hosts.
+type EnvToken struct {
+	Vars []string
+}
+
+func (e EnvToken) TokenFor(ctx context.Context, host string) (string, error) {
+	vars := e.Vars
+	if len(vars) == 0 {
+		vars = []string{"GITHUB_TOKEN", "GH_TOKEN"}
+		if host != "github.com" {
+			vars = []string{"GH_ENTERPRISE_TOKEN", "GITHUB_TOKEN"}
+		}
+	}
+
+	for _, name := range vars {
+		if val := strings.TrimSpace(os.Getenv(name)); val != "" {
+			return val, nil
+		}
+	}
+	return "", ErrNoToken
+}
+
+// FileToken reads the token from a file, for any host
+type FileToken struct {
+	Path string
+}
+
+func (f FileToken) TokenFor(ctx context.Context, host string) (string, error) {
+	data, err := readOptional(f.Path)
+	if err != nil {
+		return "", err
+	}
+	return nonEmpty(string(data))
+}
+
+// GhHostsToken reads the token of the host from the hosts.yml file
+// of the gh CLI (default: that in $GH_CONFIG_DIR, $XDG_CONFIG_HOME/gh
+// or ~/.config/gh). Tokens kept by gh in the system keyring are not
+// found.
+type GhHostsToken struct {
+	Path string
+}
+
+func (g GhHostsToken) TokenFor(ctx context.Context, host string) (string, error) {
+	path := g.Path
+	if path == "" {
+		path = ghHostsPath()
+	}
+	data, err := readOptional(path)
+	if err != nil {
+		return "", err
+	}
+	return nonEmpty(parseGhHosts(string(data), host))
+}
+
+func ghHostsPath() string {
+	if dir := os.Getenv("GH_CONFIG_DIR"); dir != "" {
+		return filepath.Join(dir, "hosts.yml")
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gh", "hosts.yml")
+	}
+	return homePath(".config", "gh", "hosts.yml")
+}
+
+// parseGhHosts returns the oauth_token of the host in a gh hosts.yml
+// file, a YAML mapping of hosts to mappings of their settings
+func parseGhHosts(data, host string) string {
+	inHost, childIndent := false, -1
+	for _, line := range strings.Split(data, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent == 0 {
+			inHost = unquote(strings.TrimSuffix(trimmed, ":")) == host
+			childIndent = -1
+			continue
+		}
+		if !inHost {
+			continue
+		}
+		if childIndent < 0 {
+			childIndent = indent
+		}
+		if indent != childIndent {
+			continue
+		}
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if ok && strings.TrimSpace(key) == "oauth_token" {
+			return unquote(strings.TrimSpace(value))
+		}
+	}
+	return ""
+}
+
+// NetrcToken reads the token of the host (or its API host, e.g.
+// api.github.com) from the password of a netrc file (default:
+// $NETRC or ~/.netrc), else from its default entry
+type NetrcToken struct {
+	Path string
+}
+
+func (n NetrcToken) TokenFor(ctx context.Context, host string) (string, error) {
+	path := n.Path
+	if path == "" {
+		path = os.Getenv("NETRC")
+	}
+	if path == "" {
+		path = homePath(".netrc")
+	}
+	data, err := readOptional(path)
+	if err != nil {
+		return "", err
+	}
+
+	var machine, fallback string
+	fields := strings.Fields(string(data))
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "default":
+			machine = ""
+		case "machine":
+			if i++; i < len(fields) {
+				machine = fields[i]
+			}
+		case "password":
+			if i++; i == len(fields) {
+				break
+			}
+			if machine == host || machine == "api."+host {
+				return fields[i], nil
+			}
+			if machine == "" && fallback == "" {
+				fallback = fields[i]
+			}
+		}
+	}
+	return nonEmpty(fallback)
+}
+
+// CommandToken runs a credential helper command, passing it the host in
+// the git credential format ("protocol=https\nhost=<host>\n\n") on its
+// standard input: the token is the password in its output, if in the
+// same format (e.g. for "git credential fill"), else the whole output.
+type CommandToken struct {
+	Name string
+	Args []string
+}
+
+func (c CommandToken) TokenFor(ctx context.Context, host string) (string, error) {
+	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=https\nhost=%s\n\n", host))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Credential helper %s: %w (%s)", c.Name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		if token, ok := strings.CutPrefix(strings.TrimSpace(line), "password="); ok {
+			return nonEmpty(token)
+		}
+	}
+	return nonEmpty(string(out))
+}
+
+// ------------------------------------------------------------------
+
+// TokenChain is a TokenRetriever resolving the token of a host from the
+// first of its sources having one. The token is resolved once, and
+// again when reloaded.
+type TokenChain struct {
+	Host    string
+	Sources []TokenSource
+
+	mu    sync.Mutex
+	token string
+}
+
+// DefaultTokenSources returns the env vars, gh CLI
+// and netrc sources, in that order
+func DefaultTokenSources() []TokenSource {
+	return []TokenSource{EnvToken{}, GhHostsToken{}, NetrcToken{}}
+}
+
+// NewTokenChain creates a TokenChain for the given host with
+// the given sources (default: DefaultTokenSources)
+func NewTokenChain(host string, sources ...TokenSource) *TokenChain {
+	if len(sources) == 0 {
+		sources = DefaultTokenSources()
+	}
+	return &TokenChain{Host: host, Sources: sources}
+}
+
+// LoadToken resolves the token again, returning ""
+// (and logging the error) if there is none
+func (c *TokenChain) LoadToken() string {
+	c.mu.Lock()
+	c.token = ""
+	c.mu.Unlock()
+	return c.Token()
+}
+
+// Token returns the token, or "" (logging the error) if there is none
+func (c *TokenChain) Token() string {
+	token, err := c.TokenWithContext(context.TODO())
+	if err != nil {
+		logging.Error("Unable to get a Github token", logging.F("err", err))
+	}
+	return token
+}
+
+// TokenWithContext returns the token, resolving it if need be. Errors
+// of sources are only returned if no other source has a token.
+func (c *TokenChain) TokenWithContext(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" {
+		return c.token, nil
+	}
+
+	var firstErr error
+	for _, src := range c.Sources {
+		token, err := src.TokenFor(ctx, c.Host)
+		if err == nil {
+			c.token = token
+			return token, nil
+		}
+		if firstErr == nil && !errors.Is(err, ErrNoToken) {
+			firstErr = err
+		}
+	}
+
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return "", fmt.Errorf("%w for %s", ErrNoToken, c.Host)
+}
+
+// ------------------------------------------------------------------
+
+func nonEmpty(token string) (string, error) {
+	if token = strings.TrimSpace(token); token == "" {
+		return "", ErrNoToken
+	}
+	return token, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// readOptional reads the file, returning ErrNoToken if it does not exist
+func readOptional(path string) ([]byte, error) {
+	if path == "" {
+		return nil, ErrNoToken
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoToken
+	}
+	return data, err
+}
+
+func homePath(elem ...string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(append([]string{home}, elem...)...)
+}
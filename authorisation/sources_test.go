@@ -0,0 +1,92 @@
+package authorisation
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestTokenSources tests finding the tokens of hosts in each source
+func TestTokenSources(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GH_TOKEN", "gh")
+	t.Setenv("GH_ENTERPRISE_TOKEN", "ghe")
+	hosts := write("hosts.yml", `github.com:
+    user: octo
+    oauth_token: gho_public
+    git_protocol: https
+"ghe.example.com":
+    users:
+        octo:
+            oauth_token: nested
+    oauth_token: 'gho_enterprise'
+`)
+	netrc := write("netrc", `machine api.github.com login octo password netrc_public
+default login anon password netrc_default
+`)
+
+	tests := []struct {
+		name  string
+		src   TokenSource
+		host  string
+		token string
+	}{
+		{"static", StaticToken("abc"), "github.com", "abc"},
+		{"env", EnvToken{}, "github.com", "gh"},
+		{"env enterprise", EnvToken{}, "ghe.example.com", "ghe"},
+		{"env unset", EnvToken{Vars: []string{"GITHUB_TOKEN"}}, "github.com", ""},
+		{"file", FileToken{write("token", " filetoken\n")}, "github.com", "filetoken"},
+		{"no file", FileToken{filepath.Join(dir, "nope")}, "github.com", ""},
+		{"gh", GhHostsToken{hosts}, "github.com", "gho_public"},
+		{"gh enterprise", GhHostsToken{hosts}, "ghe.example.com", "gho_enterprise"},
+		{"gh unknown", GhHostsToken{hosts}, "other.example.com", ""},
+		{"netrc", NetrcToken{netrc}, "github.com", "netrc_public"},
+		{"netrc default", NetrcToken{netrc}, "other.example.com", "netrc_default"},
+	}
+	if _, err := exec.LookPath("sh"); err == nil {
+		helper := CommandToken{"sh", []string{"-c", `read p; read h; echo "username=x"; echo "password=${h#host=}"`}}
+		tests = append(tests, struct {
+			name  string
+			src   TokenSource
+			host  string
+			token string
+		}{"command", helper, "ghe.example.com", "ghe.example.com"})
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := tc.src.TokenFor(context.Background(), tc.host)
+			if tc.token == "" {
+				if !errors.Is(err, ErrNoToken) {
+					t.Errorf("Expected ErrNoToken, got %q (err: %v)", token, err)
+				}
+			} else if token != tc.token || err != nil {
+				t.Errorf("Expected %q, got %q (err: %v)", tc.token, token, err)
+			}
+		})
+	}
+
+	chain := NewTokenChain("github.com", EnvToken{Vars: []string{"GITHUB_TOKEN"}}, NetrcToken{netrc})
+	if token := chain.Token(); token != "netrc_public" {
+		t.Errorf("Expected the token of the second source, got %q", token)
+	}
+	chain = NewTokenChain("github.com", FileToken{filepath.Join(dir, "nope")})
+	if _, err := chain.TokenWithContext(context.Background()); !errors.Is(err, ErrNoToken) {
+		t.Errorf("Expected ErrNoToken, got %v", err)
+	}
+	if _, err := Headers(chain, true); !errors.Is(err, ErrNoToken) {
+		t.Errorf("Expected headers to fail with ErrNoToken, got %v", err)
+	}
+}
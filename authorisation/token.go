@@ -1,14 +1,15 @@
 package authorisation
 
 import (
+	"context"
 	"errors"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/brinick/github"
+	"github.com/brinick/logging"
 )
 
 // ------------------------------------------------------------------
@@ -17,6 +18,7 @@ import (
 type APICalls struct {
 	Remaining int
 	Limit     int
+	Reset     time.Time // when the remaining calls are reset to the limit
 }
 
 // ------------------------------------------------------------------
@@ -27,6 +29,33 @@ type TokenRetriever interface {
 	Token() string
 }
 
+// ContextTokenRetriever is a TokenRetriever whose token retrieval
+// may take time and fail, e.g. as it involves requests to Github
+type ContextTokenRetriever interface {
+	TokenRetriever
+	TokenWithContext(ctx context.Context) (string, error)
+}
+
+// RateObserver is implemented by TokenRetrievers tracking the quota of
+// their tokens: clients notify them of the API calls left for a token,
+// as reported by the responses to the requests using it
+type RateObserver interface {
+	ObserveRate(token string, calls APICalls)
+}
+
+// TokenRotator is implemented by TokenRetrievers which may, without
+// waiting, provide another token in place of one that is rate limited
+type TokenRotator interface {
+	Rotate(limited string) (string, bool)
+}
+
+// Identifier is implemented by TokenRetrievers whose tokens change
+// over time, giving the identity they authenticate as (used to key
+// cached responses rather than the token itself)
+type Identifier interface {
+	Identity() string
+}
+
 // ------------------------------------------------------------------
 
 // GithubToken represents a particular Github token
@@ -35,14 +64,15 @@ type GithubToken struct {
 	apiCalls *APICalls
 }
 
-// LoadToken fetches the token from the GITHUB_TOKEN env var
+// LoadToken fetches the token from the GITHUB_TOKEN (or GH_TOKEN) env
+// var, returning "" (and logging an error) if neither is set.
+// See TokenChain for other sources of tokens.
 func (gt *GithubToken) LoadToken() string {
-	val, present := os.LookupEnv("GITHUB_TOKEN")
-	if !present {
-		panic("Please set the GITHUB_TOKEN env var")
+	val, err := EnvToken{}.TokenFor(context.TODO(), "github.com")
+	if err != nil {
+		logging.Error("Please set the GITHUB_TOKEN env var")
 	}
-
-	return strings.TrimSpace(val)
+	return val
 }
 
 // Token returns the Github token value
@@ -69,10 +99,26 @@ var (
 
 // Headers gets the HTTP headers pertaining to authorisation
 func Headers(tr TokenRetriever, useStableAPI bool) (map[string]string, error) {
+	return HeadersWithContext(context.TODO(), tr, useStableAPI)
+}
+
+// HeadersWithContext gets the HTTP headers pertaining to authorisation.
+// The context is that of the token retrieval, for ContextTokenRetrievers.
+func HeadersWithContext(ctx context.Context, tr TokenRetriever, useStableAPI bool) (map[string]string, error) {
 	if tr == nil {
 		return nil, ErrNilTokenRetriever
 	}
 
+	token := ""
+	if ctr, ok := tr.(ContextTokenRetriever); ok {
+		var err error
+		if token, err = ctr.TokenWithContext(ctx); err != nil {
+			return nil, err
+		}
+	} else {
+		token = tr.Token()
+	}
+
 	acceptVal := ""
 	if useStableAPI {
 		acceptVal += github.APIURLs.STABLE
@@ -80,15 +126,22 @@ func Headers(tr TokenRetriever, useStableAPI bool) (map[string]string, error) {
 		acceptVal += github.APIURLs.PREVIEW
 	}
 
-	tokenVal := "token " + tr.Token()
+	tokenVal := "token " + token
 	return map[string]string{"Accept": acceptVal, "Authorization": tokenVal}, nil
 }
 
 // ------------------------------------------------------------------
 
 // RateLimiting gets the remaining/limit API calls for the given token
+// from the public Github API
 func RateLimiting(token TokenRetriever) (*APICalls, error) {
-	url := filepath.Join(github.APIURLs.URL, "/rate_limit")
+	return RateLimitingAt(github.APIURLs.URL, token)
+}
+
+// RateLimitingAt gets the remaining/limit API calls for the given token
+// from the API at the given base URL
+func RateLimitingAt(baseURL string, token TokenRetriever) (*APICalls, error) {
+	url := strings.TrimRight(baseURL, "/") + "/rate_limit"
 	headers, err := Headers(token, true)
 	if err != nil {
 		return nil, err
@@ -111,6 +164,7 @@ func RateLimiting(token TokenRetriever) (*APICalls, error) {
 	defer resp.Body.Close()
 
 	remaining, limit := -1, -1
+	var reset time.Time
 	if resp.StatusCode == http.StatusOK {
 		val, keyExists := resp.Header["X-RateLimit-Remaining"]
 		if keyExists && len(val) > 0 {
@@ -126,7 +180,13 @@ func RateLimiting(token TokenRetriever) (*APICalls, error) {
 				limit = -1
 			}
 		}
+		val, keyExists = resp.Header["X-RateLimit-Reset"]
+		if keyExists && len(val) > 0 {
+			if secs, err := strconv.ParseInt(val[0], 10, 64); err == nil {
+				reset = time.Unix(secs, 0)
+			}
+		}
 	}
 
-	return &APICalls{remaining, limit}, nil
+	return &APICalls{Remaining: remaining, Limit: limit, Reset: reset}, nil
 }
@@ -1,6 +1,7 @@
 package cachedclient
 
 import (
+	"bytes"
 	"crypto/sha1"
 	"encoding/gob"
 	"errors"
@@ -8,6 +9,10 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/brinick/github/client"
 	"github.com/brinick/logging"
@@ -42,121 +47,494 @@ func createFileIfInexistant(path string) error {
 
 // ------------------------------------------------------------------
 
+// Cache stores the payloads of GET requests, along with the ETag and
+// Last-Modified values used to make them conditional. Keys are opaque
+// strings generated by the client. Implementations must be safe for
+// concurrent use; Close flushes any pending writes.
+type Cache interface {
+	Get(key string) (client.Payload, bool)
+	Set(key string, value client.Payload) error
+	Delete(key string) error
+	Close() error
+
+	// Range calls fn for each entry, until it returns false. The
+	// entries may be changed by fn, but not seeing the changes.
+	Range(fn func(key string, value client.Payload) bool)
+}
+
+// CacheSizer is implemented by caches able to report their size
+type CacheSizer interface {
+	// Len returns the number of entries in the cache
+	Len() int
+
+	// Bytes returns the size of the stored payloads
+	Bytes() int64
+}
+
+var (
+	_ CacheSizer = (*PickledCache)(nil)
+	_ CacheSizer = (*MemoryCache)(nil)
+	_ CacheSizer = (*DiskCache)(nil)
+
+	_ Cache = (*PickledCache)(nil)
+	_ Cache = (*MemoryCache)(nil)
+	_ Cache = (*DiskCache)(nil)
+)
+
+// URLKey returns the cache key depending on the URL only, under which
+// older versions cached responses. Clients use such entries as hints to
+// make conditional requests (and then rekey them), so they may be used
+// to seed a cache with responses fetched by another token.
+func URLKey(url string) string {
+	return generateCacheID([][2]string{{"url", url}})
+}
+
+// payloadSize returns the approximate size of the payload
+func payloadSize(p client.Payload) int64 {
+	return int64(len(p.Data) + len(p.ETag) + len(p.LastModified) + len(p.NextLink) + len(p.LastLink))
+}
+
+// generateCacheID returns the cache key for the given key/value entries
+func generateCacheID(entries [][2]string) string {
+	s := sha1.New()
+	for _, entry := range entries {
+		key, val := entry[0], entry[1]
+		io.WriteString(s, string(key))
+		io.WriteString(s, string(val))
+	}
+	return fmt.Sprintf("%x", s.Sum(nil))
+}
+
+// ------------------------------------------------------------------
+
 // CacheData represents the mapping of hash key
 // to the corresponding payload
 type CacheData map[string]client.Payload
 
-// PickledCache represents a pickled cache
+// cacheFileVersion is the version of the PickledCache file format.
+// Version 0 files only hold the CacheData, without access times.
+const cacheFileVersion = 1
+
+// cacheFile is the content of a PickledCache file
+type cacheFile struct {
+	Version    int
+	Entries    CacheData
+	LastAccess map[string]time.Time
+}
+
+// DefaultSaveDelay is the default delay after which changes
+// to a PickledCache are saved to file
+const DefaultSaveDelay = time.Second
+
+// PickledCache is a cache held in memory and stored as a single
+// gob-encoded file. It is safe for concurrent use.
+//
+// Changes are saved after SaveDelay, so that bursts of them are written
+// at once, and when closing the cache. The file is replaced atomically,
+// and saves are serialised via an advisory lock on a "<Path>.lock" file
+// (where supported), merging the entries saved by other processes
+// sharing the file in the meantime.
+//
+// The cache may be bounded in number of entries and bytes, evicting the
+// least recently accessed entries when saving. Access times are stored
+// in the file, so that they carry over from one program run to the next.
 type PickledCache struct {
 	Path string
-	Data CacheData
+	Data CacheData // use the Cache methods when the cache is in use
+
+	// SaveDelay is the delay after a change before saving the cache
+	// file. Zero or less saves on every change.
+	SaveDelay time.Duration
+
+	// MaxEntries and MaxBytes bound the cache size (zero or less:
+	// no bound). They are read from the GITHUB_CACHE_MAX_ENTRIES and
+	// GITHUB_CACHE_MAX_BYTES env vars by NewCacheAt.
+	MaxEntries int
+	MaxBytes   int64
+
+	mu       sync.Mutex
+	access   map[string]time.Time
+	changed  map[string]bool // keys set or deleted since the last save
+	accessed bool            // entries read since the last save
+	timer    *time.Timer
 }
 
 var errInexistantCache = errors.New("Inexistant cache")
 
 // NewCache will create and initialise a new PickledCached file
+// at the path given by the GITHUB_CACHE_FILE env var
+// (default: .github-cache in the current directory)
 func NewCache() (*PickledCache, error) {
 	cachePath, found := os.LookupEnv("GITHUB_CACHE_FILE")
 	if !found {
 		// default
 		cachePath = ".github-cache"
 	}
+	return NewCacheAt(cachePath)
+}
+
+// NewCacheAt will create and initialise a new PickledCache
+// stored in the file at the given path
+func NewCacheAt(cachePath string) (*PickledCache, error) {
 	cachePath, _ = filepath.Abs(cachePath)
 	logging.Info("Using cache file", logging.F("path", cachePath))
-	cache := &PickledCache{cachePath, nil}
+	cache := &PickledCache{
+		Path:       cachePath,
+		SaveDelay:  DefaultSaveDelay,
+		MaxEntries: int(envInt("GITHUB_CACHE_MAX_ENTRIES")),
+		MaxBytes:   envInt("GITHUB_CACHE_MAX_BYTES"),
+	}
 
 	// If this is the first time we use this cache file
 	// then it will not exist, which is ok (it will be created
-	// when we save). If however a different error is found
-	// that is not ok.
+	// when we save). If the file is unreadable, the cache
+	// starts afresh: it will be overwritten when saving.
 	if err := cache.Load(); err != nil && err != errInexistantCache {
-		logging.Fatal("Failed to create a PickledCache", logging.F("err", err))
+		logging.Error(
+			"Ignoring unreadable cache file",
+			logging.F("path", cachePath),
+			logging.F("err", err),
+		)
 	}
 	return cache, nil
 }
 
-func (pc *PickledCache) get(key string) (client.Payload, bool) {
+// Get returns the payload stored under the given key, if any
+func (pc *PickledCache) Get(key string) (client.Payload, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
 	val, found := pc.Data[key]
+	if found {
+		pc.touch(key)
+		pc.accessed = true
+	}
 	return val, found
 }
 
+// Set stores the payload under the given key
+func (pc *PickledCache) Set(key string, value client.Payload) error {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pc.Data[key] = value
+	pc.touch(key)
+	return pc.changedKey(key)
+}
+
+// Delete removes the payload stored under the given key
+func (pc *PickledCache) Delete(key string) error {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if _, found := pc.Data[key]; !found {
+		return nil
+	}
+	delete(pc.Data, key)
+	delete(pc.access, key)
+	return pc.changedKey(key)
+}
+
+// Close saves any pending changes to file
+func (pc *PickledCache) Close() error {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if len(pc.changed) == 0 && !pc.accessed {
+		pc.stopTimer()
+		return nil
+	}
+	return pc.save()
+}
+
+// Range calls fn for each entry, until it returns false
+func (pc *PickledCache) Range(fn func(key string, value client.Payload) bool) {
+	pc.mu.Lock()
+	data := make(CacheData, len(pc.Data))
+	for key, val := range pc.Data {
+		data[key] = val
+	}
+	pc.mu.Unlock()
+
+	for key, val := range data {
+		if !fn(key, val) {
+			return
+		}
+	}
+}
+
+// LastAccess returns the time the entry with the given key was last
+// set or read, which is zero for entries of legacy cache files
+func (pc *PickledCache) LastAccess(key string) (time.Time, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if _, found := pc.Data[key]; !found {
+		return time.Time{}, false
+	}
+	return pc.access[key], true
+}
+
+// Len returns the number of entries in the cache
+func (pc *PickledCache) Len() int {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return len(pc.Data)
+}
+
+// Bytes returns the size of the stored payloads
+func (pc *PickledCache) Bytes() int64 {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.bytes()
+}
+
+func (pc *PickledCache) bytes() int64 {
+	var size int64
+	for _, val := range pc.Data {
+		size += payloadSize(val)
+	}
+	return size
+}
+
+func (pc *PickledCache) touch(key string) {
+	if pc.access == nil {
+		pc.access = map[string]time.Time{}
+	}
+	pc.access[key] = time.Now()
+}
+
+// evict removes the least recently accessed entries
+// until the cache is within its bounds
+func (pc *PickledCache) evict() {
+	if pc.MaxEntries <= 0 && pc.MaxBytes <= 0 {
+		return
+	}
+
+	size := pc.bytes()
+	within := func() bool {
+		return (pc.MaxEntries <= 0 || len(pc.Data) <= pc.MaxEntries) &&
+			(pc.MaxBytes <= 0 || size <= pc.MaxBytes)
+	}
+	if within() {
+		return
+	}
+
+	keys := make([]string, 0, len(pc.Data))
+	for key := range pc.Data {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return pc.access[keys[i]].Before(pc.access[keys[j]])
+	})
+
+	evicted := 0
+	for _, key := range keys {
+		if within() {
+			break
+		}
+		size -= payloadSize(pc.Data[key])
+		delete(pc.Data, key)
+		delete(pc.access, key)
+		evicted++
+	}
+	logging.Debug("Evicted cache entries", logging.F("count", evicted))
+}
+
+// changedKey records the change of the given key,
+// and saves the cache now or schedules a save
+func (pc *PickledCache) changedKey(key string) error {
+	if pc.changed == nil {
+		pc.changed = map[string]bool{}
+	}
+	pc.changed[key] = true
+
+	if pc.SaveDelay <= 0 {
+		return pc.save()
+	}
+	if pc.timer == nil {
+		pc.timer = time.AfterFunc(pc.SaveDelay, func() {
+			pc.mu.Lock()
+			defer pc.mu.Unlock()
+			if len(pc.changed) > 0 {
+				pc.save()
+			}
+		})
+	}
+	return nil
+}
+
+func (pc *PickledCache) stopTimer() {
+	if pc.timer != nil {
+		pc.timer.Stop()
+		pc.timer = nil
+	}
+}
+
 // Load retieves the cache data from file
 // and puts in the cache data member
 func (pc *PickledCache) Load() error {
-	if !fileExists(pc.Path) {
-		pc.Data = map[string]client.Payload{}
-		return errInexistantCache
-	}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
 
-	handler, err := os.Open(pc.Path)
+	unlock, err := lockFile(pc.Path+".lock", false)
 	if err != nil {
-		logging.Error(
-			"Unable to open cache file",
-			logging.F("file", pc.Path),
-			logging.F("err", err),
-		)
+		logging.Error("Unable to lock cache file", logging.F("err", err))
 		return err
 	}
-	defer handler.Close()
+	defer unlock()
 
-	//data := new(map[string]map[string]string)
-	data := new(CacheData)
-	decoder := gob.NewDecoder(handler)
-	err = decoder.Decode(data)
+	file, err := readCacheFile(pc.Path)
 	if err != nil {
-		logging.Error("Unable to decode cache file data", logging.F("err", err))
-	} else {
-		// no error, we can update the cache data
-		pc.Data = *data
-		logging.Debug("Loaded cache file data")
+		pc.Data = CacheData{}
+		pc.access = nil
+		return err
 	}
-	return err
+
+	pc.Data = file.Entries
+	pc.access = file.LastAccess
+	pc.changed = nil
+	pc.accessed = false
+	logging.Debug("Loaded cache file data")
+	return nil
+}
+
+// Save writes the cache data to file
+func (pc *PickledCache) Save() error {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.save()
 }
 
-// Save dumps the in-memory cache data to file
-func (pc PickledCache) Save() error {
-	handler, err := os.Create(pc.Path)
+func (pc *PickledCache) save() error {
+	pc.stopTimer()
+
+	unlock, err := lockFile(pc.Path+".lock", true)
 	if err != nil {
+		logging.Error("Unable to lock cache file", logging.F("err", err))
+		return err
+	}
+	defer unlock()
+
+	// Keep the entries saved by other processes since we loaded the
+	// file, unless we changed them ourselves. Entries that others
+	// deleted may hence be written back, which is harmless.
+	if onDisk, err := readCacheFile(pc.Path); err == nil {
+		for key, val := range onDisk.Entries {
+			if !pc.changed[key] {
+				pc.Data[key] = val
+			}
+		}
+		if pc.access == nil {
+			pc.access = map[string]time.Time{}
+		}
+		for key, t := range onDisk.LastAccess {
+			if _, found := pc.Data[key]; found && t.After(pc.access[key]) {
+				pc.access[key] = t
+			}
+		}
+	}
+	pc.evict()
+
+	file := cacheFile{
+		Version:    cacheFileVersion,
+		Entries:    pc.Data,
+		LastAccess: pc.access,
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&file); err != nil {
 		logging.Error(
-			"Unable to open cache file for saving",
+			"Unable to encode cache data",
 			logging.F("err", err),
 		)
 		return err
 	}
-	defer handler.Close()
 
-	encoder := gob.NewEncoder(handler)
-	err = encoder.Encode(&pc.Data)
-	if err != nil {
+	if err := writeFileAtomic(pc.Path, buf.Bytes()); err != nil {
 		logging.Error(
 			"Unable to save cache data",
 			logging.F("err", err),
 		)
+		return err
 	}
-	return err
+
+	pc.changed = nil
+	pc.accessed = false
+	return nil
 }
 
-func (pc *PickledCache) update(d map[string]client.Payload, save bool) {
-	for key, val := range d {
-		pc.Data[key] = val
+// readCacheFile decodes the cache file at the given path,
+// in the current format or the original (version 0) one
+func readCacheFile(path string) (*cacheFile, error) {
+	if !fileExists(path) {
+		return nil, errInexistantCache
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logging.Error(
+			"Unable to read cache file",
+			logging.F("file", path),
+			logging.F("err", err),
+		)
+		return nil, err
+	}
+
+	file := &cacheFile{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(file); err != nil {
+		entries := CacheData{}
+		if legacyErr := gob.NewDecoder(bytes.NewReader(data)).Decode(&entries); legacyErr != nil {
+			logging.Error("Unable to decode cache file data", logging.F("err", err))
+			return nil, err
+		}
+		file.Entries = entries
 	}
 
-	if save {
-		pc.Save()
+	if file.Entries == nil {
+		file.Entries = CacheData{}
 	}
+	if file.LastAccess == nil {
+		file.LastAccess = map[string]time.Time{}
+	}
+	return file, nil
 }
 
-func (pc *PickledCache) delete(key string) {
-	// this is a no-op if the key is not present
-	delete(pc.Data, key)
+// envInt returns the integer value of the given env var, or zero
+func envInt(name string) int64 {
+	val, found := os.LookupEnv(name)
+	if !found {
+		return 0
+	}
+	n, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		logging.Error(
+			"Ignoring invalid integer env var",
+			logging.F("name", name),
+			logging.F("value", val),
+		)
+		return 0
+	}
+	return n
 }
 
-func (pc *PickledCache) generateCacheID(entries [][2]string) string {
-	s := sha1.New()
-	for _, entry := range entries {
-		key, val := entry[0], entry[1]
-		io.WriteString(s, string(key))
-		io.WriteString(s, string(val))
+// writeFileAtomic writes the data to a temporary file then renamed
+// to the given path, so that readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	handler, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
 	}
-	return fmt.Sprintf("%x", s.Sum(nil))
+	defer os.Remove(handler.Name())
+
+	_, err = handler.Write(data)
+	if err == nil {
+		err = handler.Sync()
+	}
+	if closeErr := handler.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(handler.Name(), path)
 }
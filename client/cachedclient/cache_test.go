@@ -0,0 +1,215 @@
+package cachedclient
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brinick/github/client"
+)
+
+// TestCaches tests the Cache implementations, and that
+// the persistent ones keep their entries once reopened
+func TestCaches(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		open func() Cache
+	}{
+		{"pickled", func() Cache {
+			c, _ := NewCacheAt(filepath.Join(dir, "cache"))
+			return c
+		}},
+		{"disk", func() Cache {
+			c, err := NewDiskCache(filepath.Join(dir, "cachedir"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return c
+		}},
+		{"memory", func() Cache { return NewMemoryCache() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.open()
+			c.Set("abc", client.Payload{Data: "[]", ETag: `"1"`})
+			c.Set("def", client.Payload{Data: "{}", ETag: `"2"`})
+			c.Delete("def")
+			c.Delete("unknown")
+			if err := c.Close(); err != nil {
+				t.Fatalf("Unexpected error closing the cache: %v", err)
+			}
+
+			if tt.name != "memory" {
+				c = tt.open()
+			}
+			if got, found := c.Get("abc"); !found || got.ETag != `"1"` {
+				t.Errorf("Expected the stored entry, got %+v (found: %v)", got, found)
+			}
+			if _, found := c.Get("def"); found {
+				t.Errorf("Expected the deleted entry to be gone")
+			}
+		})
+	}
+}
+
+// TestDiskCacheLastAccess tests that getting an entry, but
+// not ranging over the entries, updates its access time
+func TestDiskCacheLastAccess(t *testing.T) {
+	c, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Set("abc", client.Payload{Data: "[]"})
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(c.path("abc"), old, old)
+
+	c.Range(func(key string, value client.Payload) bool { return true })
+	if got, _ := c.LastAccess("abc"); got.After(old.Add(time.Second)) {
+		t.Errorf("Expected ranging not to update the access time, got %v", got)
+	}
+
+	c.Get("abc")
+	if got, found := c.LastAccess("abc"); !found || time.Since(got) > time.Minute {
+		t.Errorf("Expected getting to update the access time, got %v (found: %v)", got, found)
+	}
+}
+
+// TestDiskCacheEviction tests that the least recently
+// accessed entries are evicted beyond the bounds
+func TestDiskCacheEviction(t *testing.T) {
+	c, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.MaxEntries = 2
+	old := time.Now().Add(-time.Hour)
+	for i, key := range []string{"aaa", "bbb"} {
+		c.Set(key, client.Payload{Data: key})
+		at := old.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(c.path(key), at, at)
+	}
+	c.Get("aaa")
+	c.Set("ccc", client.Payload{Data: "ccc"})
+
+	if _, found := c.Get("bbb"); found {
+		t.Errorf("Expected the least recently accessed entry to be evicted")
+	}
+	if c.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", c.Len())
+	}
+
+	c.MaxEntries = 1
+	if err := c.Compact(); err != nil || c.Len() != 1 {
+		t.Errorf("Expected compacting to evict down to 1 entry, got %d (err: %v)", c.Len(), err)
+	}
+}
+
+// TestDiskCacheCompact tests that compacting only removes
+// the temporary files of writes long interrupted
+func TestDiskCacheCompact(t *testing.T) {
+	c, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Set("abc", client.Payload{Data: "[]"})
+	dir := filepath.Dir(c.path("abc"))
+	stale, writing := filepath.Join(dir, ".stale"), filepath.Join(dir, ".writing")
+	os.WriteFile(stale, nil, 0o600)
+	os.WriteFile(writing, nil, 0o600)
+	old := time.Now().Add(-2 * staleTempAge)
+	os.Chtimes(stale, old, old)
+
+	if err := c.Compact(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Expected the stale temporary file to be removed")
+	}
+	if _, err := os.Stat(writing); err != nil {
+		t.Errorf("Expected the recent temporary file to be kept, got %v", err)
+	}
+	if _, found := c.Get("abc"); !found {
+		t.Errorf("Expected the entry to be kept")
+	}
+}
+
+// TestMemoryCacheEviction tests that the least recently used entry is evicted
+func TestMemoryCacheEviction(t *testing.T) {
+	c := NewMemoryCache()
+	c.MaxEntries = 2
+	c.Set("a", client.Payload{Data: "a"})
+	c.Set("b", client.Payload{Data: "b"})
+	c.Get("a")
+	c.Set("c", client.Payload{Data: "c"})
+
+	if _, found := c.Get("b"); found {
+		t.Errorf("Expected the least recently used entry to be evicted")
+	}
+	if c.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", c.Len())
+	}
+}
+
+// TestPickledCacheSharing tests that concurrent changes, from several
+// goroutines and caches sharing the same file, are all saved
+func TestPickledCacheSharing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	c1, _ := NewCacheAt(path)
+	c2, _ := NewCacheAt(path)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := c1
+			if i%2 == 1 {
+				c = c2
+			}
+			c.Set(fmt.Sprint(i), client.Payload{Data: fmt.Sprint(i)})
+		}(i)
+	}
+	wg.Wait()
+	c1.Close()
+	c2.Close()
+
+	c, _ := NewCacheAt(path)
+	if len(c.Data) != 20 {
+		t.Errorf("Expected 20 entries, got %d", len(c.Data))
+	}
+}
+
+// TestPickledCacheEviction tests that the least recently accessed
+// entries are evicted, and that legacy cache files are read
+func TestPickledCacheEviction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	legacy := CacheData{
+		"a": {Data: "aaaa"},
+		"b": {Data: "bbbb"},
+	}
+	var buf bytes.Buffer
+	gob.NewEncoder(&buf).Encode(&legacy)
+	os.WriteFile(path, buf.Bytes(), 0o600)
+
+	c, _ := NewCacheAt(path)
+	if c.Len() != 2 {
+		t.Fatalf("Expected the 2 legacy entries, got %d", c.Len())
+	}
+
+	c.MaxBytes = 8
+	c.Get("a")
+	c.Set("c", client.Payload{Data: "cccc"})
+	c.Close()
+
+	c, _ = NewCacheAt(path)
+	if _, found := c.Get("b"); found || c.Len() != 2 || c.Bytes() != 8 {
+		t.Errorf("Expected the least recently accessed entry to be evicted, got %v", c.Data)
+	}
+}
@@ -1,8 +1,9 @@
 package cachedclient
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,6 +13,8 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/brinick/github"
 	"github.com/brinick/github/authorisation"
@@ -23,26 +26,76 @@ import (
 
 // ------------------------------------------------------------------
 
-// NewClient creates and initialises a new PickledCachedClient
-func NewClient() *PickledCachedClient {
+// NewClient creates and initialises a new PickledCachedClient.
+// Without options, the token of the API host is resolved from the
+// default sources (see authorisation.DefaultTokenSources) on first
+// use, and the cache file is read from GITHUB_CACHE_FILE (see NewCache).
+func NewClient(opts ...Option) *PickledCachedClient {
 	c := new(PickledCachedClient)
-	c.APIToken = authorisation.NewToken()
 	c.APIURL = github.APIURLs.URL
-	cache, _ := NewCache()
-	c.cache = cache
+	c.UploadsURL = github.APIURLs.UPLOADS
+	c.GraphQLURL = github.APIURLs.GRAPHQL
+	c.retry = DefaultRetryPolicy
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.APIToken == nil {
+		c.APIToken = authorisation.NewTokenChain(authorisation.HostOf(c.APIURL))
+	}
+	if c.cache == nil {
+		c.cache, _ = NewCache()
+	}
+	c.httpClient = c.transport.build()
 	return c
 }
 
 // ---------------------------------------------------------------
 
+var _ client.IGithubClient = (*PickledCachedClient)(nil)
+
 // PickledCachedClient represents a Github client that caches data
 type PickledCachedClient struct {
-	APIToken *authorisation.GithubToken
-	APIURL   string
-	cache    *PickledCache
+	APIToken   authorisation.TokenRetriever
+	APIURL     string
+	UploadsURL string
+	GraphQLURL string
+	cache      Cache
+
+	rateLimitWait time.Duration
+	onRateLimit   RateLimitCallback
+	retry         RetryPolicy
+	transport     transportConfig
+	httpClient    *http.Client
+
+	mu    sync.Mutex
+	mode  NetworkMode
+	rate  client.RateLimit
+	stats CacheStats
+	index urlIndex
+}
+
+// Close closes the cache, flushing any pending writes
+func (c *PickledCachedClient) Close() error {
+	return c.cache.Close()
 }
 
-func (c PickledCachedClient) makeURL(urlTpl string, kwds ...interface{}) string {
+// Endpoints returns the API URLs this client talks to
+func (c *PickledCachedClient) Endpoints() github.API {
+	api := github.APIURLs
+	api.URL = c.APIURL
+	api.UPLOADS = c.UploadsURL
+	api.GRAPHQL = c.GraphQLURL
+	return api
+}
+
+// HTTPClient returns the long-lived HTTP client, built from the
+// transport options, with which this client sends its requests
+func (c *PickledCachedClient) HTTPClient() *http.Client {
+	return c.httpClient
+}
+
+func (c *PickledCachedClient) makeURL(urlTpl string, kwds ...interface{}) string {
 	if strings.HasPrefix(urlTpl, "/") {
 		urlTpl = urlTpl[1:]
 	}
@@ -54,124 +107,173 @@ func (c PickledCachedClient) makeURL(urlTpl string, kwds ...interface{}) string
 	return u.String()
 }
 
-func (c PickledCachedClient) rateLimiting() (*authorisation.APICalls, error) {
-	return authorisation.RateLimiting(c.APIToken)
+func (c *PickledCachedClient) rateLimiting() (*authorisation.APICalls, error) {
+	return authorisation.RateLimitingAt(c.APIURL, c.APIToken)
+}
+
+// cacheKey returns the cache key of a GET of the given URL with the
+// given headers. Responses depend on the API host, the requested media
+// type and the token, which determines the resources visible: the token
+// (or the identity of authorisation.Identifier token retrievers, whose
+// tokens change) is hashed, so as not to be stored in the cache.
+func (c *PickledCachedClient) cacheKey(url string, headers map[string]string) string {
+	identity := headers["Authorization"]
+	if id, ok := c.APIToken.(authorisation.Identifier); ok {
+		identity = id.Identity()
+	}
+	token := sha256.Sum256([]byte(identity))
+	return generateCacheID([][2]string{
+		{"base", c.APIURL},
+		{"accept", headers["Accept"]},
+		{"token", hex.EncodeToString(token[:])},
+		{"url", url},
+	})
 }
 
 // ---------------------------------------------------------------
 
-// Post executes an HTTP POST operation, returning a status code and error.
+// Post executes an HTTP POST operation, returning the response.
 func (c *PickledCachedClient) Post(
 	url string,
 	useStableAPI bool,
-	data map[string]string,
-) (int, error) {
+	data interface{},
+) (*client.Response, error) {
 	return c.PostWithContext(context.TODO(), url, useStableAPI, data)
 }
 
-// PostWithContext executes an HTTP POST operation, returning a status code.
+// PostWithContext executes an HTTP POST operation, returning the response.
 // It may be cancelled via a context
 func (c *PickledCachedClient) PostWithContext(
 	ctx context.Context,
 	url string,
 	useStableAPI bool,
-	data map[string]string,
-) (int, error) {
+	data interface{},
+) (*client.Response, error) {
+	return c.write(ctx, "POST", url, useStableAPI, data)
+}
 
-	headers, err := client.PostHeaders(c.APIToken, useStableAPI)
-	if err != nil {
-		return 0, err
-	}
+// ---------------------------------------------------------------
 
-	// url = c.makeURL(url, kwds...)
-	jsonStr, err := json.Marshal(data)
-	if err != nil {
-		logging.Error(
-			"Unable to JSON encode the HTTP post data",
-			logging.F("err", err),
-		)
-		return 0, err
-	}
+// Patch executes an HTTP PATCH operation, returning the response.
+func (c *PickledCachedClient) Patch(
+	url string,
+	useStableAPI bool,
+	data interface{},
+) (*client.Response, error) {
+	return c.PatchWithContext(context.TODO(), url, useStableAPI, data)
+}
 
-	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonStr))
-	if ctx != nil {
-		req = req.WithContext(ctx)
-	}
+// PatchWithContext executes an HTTP PATCH operation, returning the response.
+// It may be cancelled via the context.
+func (c *PickledCachedClient) PatchWithContext(
+	ctx context.Context,
+	url string,
+	useStableAPI bool,
+	data interface{},
+) (*client.Response, error) {
+	return c.write(ctx, "PATCH", url, useStableAPI, data)
+}
 
-	for key, val := range headers {
-		req.Header.Set(key, val)
-	}
-	// req.Header.Set("Content-Type", "application/json")
+// Put executes an HTTP PUT operation, returning the response.
+func (c *PickledCachedClient) Put(
+	url string,
+	useStableAPI bool,
+	data interface{},
+) (*client.Response, error) {
+	return c.PutWithContext(context.TODO(), url, useStableAPI, data)
+}
 
-	httpClient := &http.Client{}
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		logging.Error(
-			"Unable to make HTTP POST",
-			logging.F("err", err),
-		)
-		return 0, err
-	}
-	defer resp.Body.Close()
-	return resp.StatusCode, nil
+// PutWithContext executes an HTTP PUT operation, returning the response.
+// It may be cancelled via the context.
+func (c *PickledCachedClient) PutWithContext(
+	ctx context.Context,
+	url string,
+	useStableAPI bool,
+	data interface{},
+) (*client.Response, error) {
+	return c.write(ctx, "PUT", url, useStableAPI, data)
 }
 
 // ---------------------------------------------------------------
 
-// Patch executes an HTTP PATCH operation, returning a status code.
-func (c *PickledCachedClient) Patch(
+// Delete executes an HTTP DELETE operation, returning the response.
+// Most Github DELETE endpoints take no body, in which case data is nil.
+func (c *PickledCachedClient) Delete(
 	url string,
 	useStableAPI bool,
-	data map[string]string,
-) (int, error) {
-	return c.PatchWithContext(context.TODO(), url, useStableAPI, data)
+	data interface{},
+) (*client.Response, error) {
+	return c.DeleteWithContext(context.TODO(), url, useStableAPI, data)
 }
 
-// PatchWithContext executes an HTTP PATCH operation, returning a status code.
+// DeleteWithContext executes an HTTP DELETE operation, returning the response.
 // It may be cancelled via the context.
-func (c *PickledCachedClient) PatchWithContext(
+func (c *PickledCachedClient) DeleteWithContext(
 	ctx context.Context,
 	url string,
 	useStableAPI bool,
-	data map[string]string,
-) (int, error) {
+	data interface{},
+) (*client.Response, error) {
+	return c.write(ctx, "DELETE", url, useStableAPI, data)
+}
 
-	headers, err := client.PostHeaders(c.APIToken, useStableAPI)
-	if err != nil {
-		return 0, err
+// ---------------------------------------------------------------
+
+// write executes an HTTP operation sending the JSON encoded data (if any),
+// returning the response. For unsuccessful status codes, both
+// the response and an *client.APIError are returned.
+func (c *PickledCachedClient) write(
+	ctx context.Context,
+	method string,
+	url string,
+	useStableAPI bool,
+	data interface{},
+) (*client.Response, error) {
+
+	if c.NetworkMode() == Offline {
+		return nil, client.ErrOffline
 	}
 
-	// url = c.makeURL(url, kwds...)
-	jsonStr, err := json.Marshal(data)
+	headers, err := client.PostHeadersWithContext(ctx, c.APIToken, useStableAPI)
 	if err != nil {
-		logging.Error(
-			"Unable to JSON encode the HTTP post data",
-			logging.F("err", err),
-		)
-		return 0, err
+		return nil, err
 	}
 
-	req, _ := http.NewRequest("PATCH", url, bytes.NewBuffer(jsonStr))
-
-	if ctx != nil {
-		req = req.WithContext(ctx)
-	}
-	for key, val := range headers {
-		req.Header.Set(key, val)
+	var jsonStr []byte
+	if data != nil {
+		jsonStr, err = json.Marshal(data)
+		if err != nil {
+			logging.Error(
+				"Unable to JSON encode the HTTP post data",
+				logging.F("err", err),
+			)
+			return nil, err
+		}
 	}
-	// req.Header.Set("Content-Type", "application/json")
 
-	httpClient := &http.Client{}
-	resp, err := httpClient.Do(req)
+	resp, attempts, err := c.do(ctx, method, url, jsonStr, headers)
 	if err != nil {
 		logging.Error(
-			"Error making HTTP PATCH action",
+			"Unable to make HTTP "+method,
 			logging.F("err", err),
 		)
-		return 0, err
+		return nil, err
 	}
-	resp.Body.Close()
-	return resp.StatusCode, nil
+	defer resp.Body.Close()
+
+	response := &client.Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       readBody(resp),
+		Attempts:   attempts,
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return response, newAPIError(method, url, resp)
+	}
+
+	c.invalidateAfterWrite(method, url)
+	return response, nil
 }
 
 // ---------------------------------------------------------------
@@ -196,52 +298,67 @@ func (c *PickledCachedClient) GetWithContext(
 
 	// logging.Info("GET", logging.F("url", url))
 
-	entry := [2]string{"url", url}
-	input := [][2]string{entry}
-	cacheKey := c.cache.generateCacheID(input)
-	cacheValue, keyFound := c.cache.get(cacheKey)
-	etag := ""
-	last := ""
-	if keyFound {
-		etag = cacheValue.ETag
-		last = cacheValue.LastModified
+	headers, err := client.GetHeadersWithContext(ctx, c.APIToken, useStableAPI, "", "")
+	if err != nil {
+		return &client.Page{URL: url, Err: err}
 	}
 
-	req, _ := http.NewRequest("GET", url, nil)
-	if ctx != nil {
-		req = req.WithContext(ctx)
+	cacheKey := c.cacheKey(url, headers)
+	mode := c.NetworkMode()
+	if mode == Offline {
+		return c.stalePage(url, cacheKey, client.ErrOffline, false)
 	}
-
-	headers, err := client.GetHeaders(c.APIToken, useStableAPI, etag, last)
-	if err != nil {
-		return &client.Page{URL: url, Err: err}
+	cacheValue, keyFound := c.cache.Get(cacheKey)
+
+	// Entries cached by older versions are keyed on the URL only, and
+	// may have been fetched with another token or media type. They are
+	// only used to make the request conditional: if Github answers 304,
+	// the entry is valid for this request too, and is rekeyed.
+	legacyKey := ""
+	if !keyFound {
+		legacyKey = URLKey(url)
+		cacheValue, keyFound = c.cache.Get(legacyKey)
+		if !keyFound {
+			legacyKey = ""
+		}
 	}
 
-	for key, val := range headers {
-		req.Header.Set(key, val)
+	etag := ""
+	last := ""
+	if keyFound {
+		etag = cacheValue.ETag
+		last = cacheValue.LastModified
+		if etag != "" {
+			headers["If-None-Match"] = etag
+		}
+		if last != "" {
+			headers["If-Modified-Since"] = last
+		}
 	}
 
-	httpClient := &http.Client{}
-	resp, err := httpClient.Do(req)
+	resp, attempts, err := c.do(ctx, "GET", url, nil, headers)
 
 	if err != nil {
-		select {
-		case <-ctx.Done():
+		if ctx != nil && ctx.Err() != nil {
 			logging.Info(
 				"Context done, cancelling HTTP GET",
 				logging.F("url", url),
 			)
 			err = ctx.Err()
-
-		default:
+		} else {
 			logging.Error(
 				"Unable to make GET request",
 				logging.F("err", err),
 				logging.F("url", url),
 			)
+			if mode == OfflineFallback {
+				page := c.stalePage(url, cacheKey, err, true)
+				page.Attempts = attempts
+				return page
+			}
 		}
 
-		return &client.Page{URL: url, Err: err}
+		return &client.Page{URL: url, Err: err, Attempts: attempts}
 	}
 
 	// TODO: We're ignoring the context from here onwards, as it's assumed
@@ -253,6 +370,12 @@ func (c *PickledCachedClient) GetWithContext(
 	// -----------------------------------------
 	// Exists, but nothing changed
 	if statusCode == http.StatusNotModified {
+		c.recordCacheHit()
+		if legacyKey != "" {
+			cacheValue.URL = url
+			c.cacheSet(cacheKey, cacheValue)
+			c.cache.Delete(legacyKey)
+		}
 		nextLink := cacheValue.NextLink
 		data := cacheValue.Data
 		return &client.Page{
@@ -262,31 +385,48 @@ func (c *PickledCachedClient) GetWithContext(
 				ETag:         etag,
 				LastModified: last,
 				NextLink:     nextLink,
+				LastLink:     cacheValue.LastLink,
+				URL:          url,
 			},
 			StatusCode: http.StatusNotModified,
+			Attempts:   attempts,
 		}
 	}
-	// If we get here, then we have a cache miss
-	c.cache.delete(cacheKey)
 
 	// -----------------------------------------
-	// Inexistant
-	if statusCode == http.StatusNotFound {
-		return &client.Page{
-			URL:        url,
-			Err:        errors.New("Not found"),
-			StatusCode: http.StatusNotFound,
+	// Github unavailable, answer from the cache if allowed
+	if mode == OfflineFallback && unavailable(resp) {
+		page := c.stalePage(url, cacheKey, newAPIError("GET", url, resp), true)
+		page.Attempts = attempts
+		if page.Err != nil {
+			page.StatusCode = statusCode
+		} else {
+			logging.Info(
+				"Github unavailable, serving cached response",
+				logging.F("url", url),
+				logging.F("statuscode", statusCode),
+			)
 		}
+		return page
+	}
+
+	// If we get here, then we have a cache miss
+	c.cacheDelete(cacheKey, url)
+	if legacyKey != "" {
+		c.cache.Delete(legacyKey)
 	}
 
 	// -----------------------------------------
-	// Nope
-	if statusCode == http.StatusForbidden {
-		logging.Info("Forbidden", logging.F("statuscode", http.StatusForbidden))
+	// Inexistant, forbidden, rate limited...
+	if statusCode >= http.StatusBadRequest {
+		if statusCode == http.StatusForbidden {
+			logging.Info("Forbidden", logging.F("statuscode", http.StatusForbidden))
+		}
 		return &client.Page{
 			URL:        url,
-			Err:        errors.New("Forbidden"),
-			StatusCode: http.StatusForbidden,
+			Err:        newAPIError("GET", url, resp),
+			StatusCode: statusCode,
+			Attempts:   attempts,
 		}
 	}
 
@@ -307,6 +447,7 @@ func (c *PickledCachedClient) GetWithContext(
 				URL:        url,
 				Err:        errors.New(errmsg),
 				StatusCode: http.StatusOK,
+				Attempts:   attempts,
 			}
 		}
 
@@ -315,25 +456,25 @@ func (c *PickledCachedClient) GetWithContext(
 		etag = resp.Header.Get("ETag")
 		last = resp.Header.Get("Last-Modified")
 		nextLink := parseNextLink(resp.Header.Get("Link"))
+		lastLink := parseLastLink(resp.Header.Get("Link"))
 
 		cacheValue = client.Payload{
 			Data:         payload,
 			ETag:         etag,
 			LastModified: last,
 			NextLink:     nextLink,
+			LastLink:     lastLink,
+			URL:          url,
 		}
 
-		c.cache.update(
-			map[string]client.Payload{
-				cacheKey: cacheValue,
-			},
-			true,
-		)
+		c.cacheSet(cacheKey, cacheValue)
+		c.recordCacheMiss()
 
 		return &client.Page{
 			URL:        url,
 			Content:    &cacheValue,
 			StatusCode: http.StatusOK,
+			Attempts:   attempts,
 		}
 
 	}
@@ -345,42 +486,54 @@ func (c *PickledCachedClient) GetWithContext(
 			Data:         "",
 			ETag:         resp.Header.Get("ETag"),
 			LastModified: resp.Header.Get("Last-Modified"),
+			URL:          url,
 		}
 
-		c.cache.update(
-			map[string]client.Payload{
-				cacheKey: cacheValue,
-			},
-			true,
-		)
+		c.cacheSet(cacheKey, cacheValue)
+		c.recordCacheMiss()
 
 		return &client.Page{
 			Content:    &cacheValue,
 			StatusCode: http.StatusNoContent,
+			Attempts:   attempts,
 		}
 	}
 
 	// -----------------------------------------
 
 	return &client.Page{
-		Err:        fmt.Errorf("HTTP GET request returned status code %d", statusCode),
+		URL:        url,
+		Err:        newAPIError("GET", url, resp),
 		StatusCode: statusCode,
+		Attempts:   attempts,
 	}
 
 }
 
 func parseNextLink(nextLink string) string {
-	if nextLink == "" {
+	return parseLink(nextLink, "next")
+}
+
+func parseLastLink(lastLink string) string {
+	return parseLink(lastLink, "last")
+}
+
+// parseLink returns the URL of the given relation in a Link header
+func parseLink(header, rel string) string {
+	if header == "" {
 		// If there is only one page of results, the Link header is empty
 		return ""
 	}
 
-	links := strings.Split(nextLink, ",")
+	links := strings.Split(header, ",")
 	for _, link := range links {
 		tokens := strings.Split(link, ";")
+		if len(tokens) < 2 {
+			continue
+		}
 		url, what := tokens[0], tokens[1]
 		what = strings.TrimSpace(what)
-		if strings.HasPrefix(what, "rel=\"next\"") {
+		if strings.HasPrefix(what, "rel=\""+rel+"\"") {
 			url = strings.TrimSpace(url)
 			url = strings.Trim(url, "<>")
 			return url
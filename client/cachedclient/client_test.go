@@ -0,0 +1,383 @@
+package cachedclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/brinick/github/authorisation"
+	"github.com/brinick/github/client"
+)
+
+type staticToken string
+
+func (s staticToken) LoadToken() string { return string(s) }
+func (s staticToken) Token() string     { return string(s) }
+
+func newTestClient(t *testing.T, opts ...Option) *PickledCachedClient {
+	opts = append(
+		[]Option{
+			WithToken(staticToken("abc123")),
+			WithCacheFile(filepath.Join(t.TempDir(), "cache")),
+		},
+		opts...,
+	)
+	c := NewClient(opts...)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// ------------------------------------------------------------------
+
+// TestRetry tests that transient failures are retried for GETs, but not for POSTs
+func TestRetry(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls%2 == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"id": 1}`))
+	}))
+	defer srv.Close()
+
+	policy := DefaultRetryPolicy
+	policy.BaseDelay = time.Millisecond
+	c := newTestClient(t, WithRetryPolicy(policy))
+
+	page := c.Get(srv.URL+"/repos/octo/hello", true)
+	if page.Err != nil {
+		t.Fatalf("Unexpected error: %v", page.Err)
+	}
+	if page.Attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", page.Attempts)
+	}
+
+	calls = 0
+	resp, _ := c.Post(srv.URL+"/repos/octo/hello/issues", true, nil)
+	if resp.StatusCode != http.StatusBadGateway || calls != 1 {
+		t.Errorf("Expected a single failed POST, got status %d after %d calls", resp.StatusCode, calls)
+	}
+}
+
+// TestMiddleware tests that middlewares wrap the transport in order
+func TestMiddleware(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Trace")))
+	}))
+	defer srv.Close()
+
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+
+	c := newTestClient(
+		t,
+		WithTimeout(time.Second),
+		WithMiddleware(trace("outer"), SetHeader("X-Trace", "abc")),
+		WithMiddleware(trace("inner")),
+	)
+
+	page := c.Get(srv.URL+"/user", true)
+	if page.Err != nil {
+		t.Fatalf("Unexpected error: %v", page.Err)
+	}
+	if got := string(page.Content.Data); got != "abc" {
+		t.Errorf("Expected the injected header value, got %q", got)
+	}
+	if len(order) != 2 || order[0] != "outer" || order[1] != "inner" {
+		t.Errorf("Unexpected middleware order: %v", order)
+	}
+	if c.HTTPClient().Timeout != time.Second {
+		t.Errorf("Expected the timeout to be set, got %v", c.HTTPClient().Timeout)
+	}
+}
+
+// TestStats tests the counting of cache hits and misses
+func TestStats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"1"`)
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, WithCache(NewMemoryCache()))
+	for i := 0; i < 3; i++ {
+		c.Get(srv.URL+"/repos/octo/hello/issues", true)
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.RequestsSaved != 2 {
+		t.Errorf("Unexpected hits and misses: %+v", stats)
+	}
+	if stats.Entries != 1 || stats.Bytes != 5 {
+		t.Errorf("Unexpected cache size: %+v", stats)
+	}
+}
+
+// TestCacheKey tests that responses are cached per token, and that
+// entries keyed on the URL only are reused once validated, then rekeyed
+func TestCacheKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := `"` + r.Header.Get("Authorization") + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer srv.Close()
+
+	url := srv.URL + "/user/repos"
+	cache := NewMemoryCache()
+	cache.Set(
+		URLKey(url),
+		client.Payload{Data: "legacy", ETag: `"token abc123"`},
+	)
+
+	c1 := newTestClient(t, WithCache(cache))
+	c2 := newTestClient(t, WithCache(cache), WithToken(staticToken("def456")))
+
+	if page := c1.Get(url, true); page.StatusCode != http.StatusNotModified || page.Content.Data != "legacy" {
+		t.Errorf("Expected the validated legacy entry, got %d %+v", page.StatusCode, page.Content)
+	}
+	if page := c2.Get(url, true); page.StatusCode != http.StatusOK || page.Content.Data != "token def456" {
+		t.Errorf("Expected a fresh response for another token, got %d %+v", page.StatusCode, page.Content)
+	}
+	if page := c1.Get(url, true); page.StatusCode != http.StatusNotModified || page.Content.Data != "legacy" {
+		t.Errorf("Expected the rekeyed entry, got %d %+v", page.StatusCode, page.Content)
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Expected an entry per token, got %d entries", cache.Len())
+	}
+}
+
+// TestInvalidate tests that writes and explicit invalidations
+// make the next GETs of the resources affected unconditional
+func TestInvalidate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"1"`)
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, WithBaseURL(srv.URL), WithCache(NewMemoryCache()))
+	statuses := srv.URL + "/repos/octo/hello/commits/abc/statuses"
+	issues := srv.URL + "/repos/octo/hello/issues?state=open&page=2"
+	c.Get(statuses, true)
+	c.Get(issues, true)
+
+	if _, err := c.Post(srv.URL+"/repos/octo/hello/statuses/abc", true, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if page := c.Get(statuses, true); page.StatusCode != http.StatusOK {
+		t.Errorf("Expected the statuses to be refetched, got %d", page.StatusCode)
+	}
+	if page := c.Get(issues, true); page.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected the issues to still be cached, got %d", page.StatusCode)
+	}
+
+	comment := srv.URL + "/repos/octo/hello/issues/comments/7"
+	issueComments := srv.URL + "/repos/octo/hello/issues/3/comments?per_page=2"
+	c.Get(comment, true)
+	c.Get(issueComments, true)
+	if _, err := c.Patch(comment, true, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if page := c.Get(issues, true); page.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected the issues to still be cached after a comment edit, got %d", page.StatusCode)
+	}
+	if page := c.Get(comment, true); page.StatusCode != http.StatusOK {
+		t.Errorf("Expected the comment to be refetched, got %d", page.StatusCode)
+	}
+	if page := c.Get(issueComments, true); page.StatusCode != http.StatusOK {
+		t.Errorf("Expected the comments of the issue to be refetched, got %d", page.StatusCode)
+	}
+
+	if _, err := c.Patch(srv.URL+"/repos/octo/hello/issues/3", true, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if page := c.Get(issues, true); page.StatusCode != http.StatusOK {
+		t.Errorf("Expected the issues list to be refetched after an issue edit, got %d", page.StatusCode)
+	}
+
+	// the issues list and the comment
+	if n := c.Invalidate(srv.URL + "/repos/octo/hello/issues"); n != 2 {
+		t.Errorf("Expected 2 invalidated responses, got %d", n)
+	}
+	if n := c.Invalidate(srv.URL + "/repos/octo/hel"); n != 0 {
+		t.Errorf("Expected no invalidated response, got %d", n)
+	}
+}
+
+// TestOffline tests that offline clients answer GETs from the cache,
+// following the next page links, and refuse writes
+func TestOffline(t *testing.T) {
+	down := false
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Query().Get("page") == "" {
+			w.Header().Set("Link", `<`+srv.URL+r.URL.Path+`?page=2>; rel="next"`)
+		}
+		w.Write([]byte(`["` + r.URL.String() + `"]`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, WithCache(NewMemoryCache()), WithRetryPolicy(NoRetryPolicy))
+	pages := func() int {
+		n := 0
+		it := client.NewGithubPageIterator(srv.URL+"/repos/octo/hello/issues", c)
+		for page := it.Next(); page != nil && page.Err == nil; page = it.Next() {
+			n++
+		}
+		return n
+	}
+	if n := pages(); n != 2 {
+		t.Fatalf("Expected 2 pages online, got %d", n)
+	}
+
+	down = true
+	c.SetNetworkMode(Offline)
+	if n := pages(); n != 2 {
+		t.Errorf("Expected 2 cached pages offline, got %d", n)
+	}
+	if page := c.Get(srv.URL+"/repos/octo/hello/pulls", true); !errors.Is(page.Err, client.ErrOffline) {
+		t.Errorf("Expected ErrOffline for an uncached page, got %v", page.Err)
+	}
+	if _, err := c.Post(srv.URL+"/repos/octo/hello/issues", true, nil); !errors.Is(err, client.ErrOffline) {
+		t.Errorf("Expected ErrOffline for a write, got %v", err)
+	}
+
+	c.SetNetworkMode(OfflineFallback)
+	if page := c.Get(srv.URL+"/repos/octo/hello/issues", true); page.Err != nil || !page.Stale {
+		t.Errorf("Expected a stale page while Github is down, got %+v", page)
+	}
+	if page := c.Get(srv.URL+"/repos/octo/hello/pulls", true); page.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected the error of Github for an uncached page, got %+v", page)
+	}
+
+	if stats := c.Stats(); stats.Stale != 3 || stats.RequestsSaved != 2 {
+		t.Errorf("Unexpected stale pages count: %+v", stats)
+	}
+	// entries of older versions are keyed on the URL only
+	legacy := srv.URL + "/repos/octo/hello/branches"
+	c.cache.Set(URLKey(legacy), client.Payload{Data: `["main"]`})
+	for _, mode := range []NetworkMode{Offline, OfflineFallback} {
+		c.SetNetworkMode(mode)
+		if page := c.Get(legacy, true); page.Err != nil || page.Content.Data != `["main"]` {
+			t.Errorf("Expected the legacy entry to be served %s, got %+v", mode, page)
+		}
+	}
+}
+
+// TestTokenPool tests that the client reports the quota of the tokens
+// of a pool, and switches token when one hits the rate limit
+func TestTokenPool(t *testing.T) {
+	reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Reset", reset)
+		if r.Header.Get("Authorization") == "token first" {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message": "API rate limit exceeded"}`))
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "4000")
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	pool := authorisation.NewTokenPool("first", "second")
+	c := newTestClient(t, WithToken(pool))
+	if page := c.Get(srv.URL+"/repos/octo/hello", true); page.Err != nil || page.Attempts != 2 {
+		t.Fatalf("Expected a retry with the second token, got %d attempts (err: %v)", page.Attempts, page.Err)
+	}
+
+	calls := pool.Remaining()
+	if calls[0].Remaining != 0 || calls[1].Remaining != 4000 {
+		t.Errorf("Expected the observed quotas, got %+v", calls)
+	}
+	if token := pool.Token(); token != "second" {
+		t.Errorf("Expected the token with calls remaining, got %q", token)
+	}
+}
+
+// TestRateLimitPastReset tests that a rate limit whose reset time has
+// already passed (e.g. with clock skew) does not make requests spin
+func TestRateLimitPastReset(t *testing.T) {
+	calls := 0
+	reset := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", reset)
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message": "API rate limit exceeded"}`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t)
+	page := c.Get(srv.URL+"/repos/octo/hello", true)
+	if !errors.Is(page.Err, client.ErrRateLimited) || calls != 1 {
+		t.Errorf("Expected to fail at once without waiting, got %d calls (err: %v)", calls, page.Err)
+	}
+
+	calls = 0
+	c = newTestClient(t, WithRateLimitWait(time.Minute))
+	page = c.Get(srv.URL+"/repos/octo/hello", true)
+	if !errors.Is(page.Err, client.ErrRateLimited) || calls != maxRateLimitRetries+1 {
+		t.Errorf("Expected %d calls, got %d (err: %v)", maxRateLimitRetries+1, calls, page.Err)
+	}
+}
+
+// TestTokenPoolPastReset tests that requests do not switch endlessly
+// between rate limited tokens whose reset times have already passed
+func TestTokenPoolPastReset(t *testing.T) {
+	calls := 0
+	reset := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", reset)
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message": "API rate limit exceeded"}`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, WithToken(authorisation.NewTokenPool("first", "second")))
+	page := c.Get(srv.URL+"/repos/octo/hello", true)
+	if !errors.Is(page.Err, client.ErrRateLimited) || calls != 2 {
+		t.Errorf("Expected to try each token once, got %d calls (err: %v)", calls, page.Err)
+	}
+}
@@ -0,0 +1,337 @@
+package cachedclient
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brinick/github/client"
+	"github.com/brinick/logging"
+)
+
+// DiskCache is a cache storing each entry in its own gob-encoded file
+// under a directory. Unlike a PickledCache, it neither loads all entries
+// in memory nor rewrites them all on each change, which suits large
+// caches and long-running programs. Entries are written atomically.
+type DiskCache struct {
+	Dir string
+
+	// MaxEntries and MaxBytes bound the number and total size of the
+	// entry files (zero or less: no bound), the least recently accessed
+	// entries being evicted beyond them. They are read from the
+	// GITHUB_CACHE_MAX_ENTRIES and GITHUB_CACHE_MAX_BYTES env vars by
+	// NewDiskCache. Entries set by other processes sharing the directory
+	// are only counted from the next eviction.
+	MaxEntries int
+	MaxBytes   int64
+
+	mu      sync.Mutex
+	counted bool // n and size are known
+	n       int
+	size    int64
+}
+
+// NewDiskCache creates a cache stored under the given directory,
+// creating the latter if need be
+func NewDiskCache(dir string) (*DiskCache, error) {
+	dir, _ = filepath.Abs(dir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		logging.Error(
+			"Unable to create cache directory",
+			logging.F("dir", dir),
+			logging.F("err", err),
+		)
+		return nil, err
+	}
+	logging.Info("Using cache directory", logging.F("path", dir))
+	return &DiskCache{
+		Dir:        dir,
+		MaxEntries: int(envInt("GITHUB_CACHE_MAX_ENTRIES")),
+		MaxBytes:   envInt("GITHUB_CACHE_MAX_BYTES"),
+	}, nil
+}
+
+// path returns the file of the entry with the given key. Entries are
+// spread over subdirectories named after the first key characters.
+func (dc *DiskCache) path(key string) string {
+	if len(key) < 3 {
+		return filepath.Join(dc.Dir, "_", key)
+	}
+	return filepath.Join(dc.Dir, key[:2], key)
+}
+
+// Get returns the payload stored under the given key, if any,
+// updating the modification time of its file to record the access
+func (dc *DiskCache) Get(key string) (client.Payload, bool) {
+	value, found := dc.read(key)
+	if found {
+		now := time.Now()
+		os.Chtimes(dc.path(key), now, now)
+	}
+	return value, found
+}
+
+// read returns the payload stored under the given key, if any
+func (dc *DiskCache) read(key string) (client.Payload, bool) {
+	var value client.Payload
+
+	handler, err := os.Open(dc.path(key))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logging.Error("Unable to open cache entry", logging.F("err", err))
+		}
+		return value, false
+	}
+	defer handler.Close()
+
+	if err := gob.NewDecoder(handler).Decode(&value); err != nil {
+		logging.Error(
+			"Unable to decode cache entry",
+			logging.F("key", key),
+			logging.F("err", err),
+		)
+		return client.Payload{}, false
+	}
+	return value, true
+}
+
+// Set stores the payload under the given key, evicting the least
+// recently accessed entries if the cache is beyond its bounds
+func (dc *DiskCache) Set(key string, value client.Payload) error {
+	path := dc.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(&value)
+	if err == nil {
+		from := dc.fileSize(key)
+		if err = writeFileAtomic(path, buf.Bytes()); err == nil {
+			dc.changed(key, from, int64(buf.Len()))
+		}
+	}
+	if err != nil {
+		logging.Error(
+			"Unable to save cache entry",
+			logging.F("key", key),
+			logging.F("err", err),
+		)
+	}
+	return err
+}
+
+// Delete removes the payload stored under the given key
+func (dc *DiskCache) Delete(key string) error {
+	from := dc.fileSize(key)
+	err := os.Remove(dc.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err == nil {
+		dc.changed(key, from, -1)
+	}
+	return err
+}
+
+// fileSize returns the size of the file of the
+// entry with the given key, or -1 if there is none
+func (dc *DiskCache) fileSize(key string) int64 {
+	info, err := os.Stat(dc.path(key))
+	if err != nil {
+		return -1
+	}
+	return info.Size()
+}
+
+// changed updates the number and size of the entry files after that
+// of the given key changed size (-1: no file), and evicts entries
+// other than it if the cache is then beyond its bounds
+func (dc *DiskCache) changed(key string, from, to int64) {
+	if dc.MaxEntries <= 0 && dc.MaxBytes <= 0 {
+		return
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	if !dc.counted {
+		dc.n, dc.size = dc.count()
+		dc.counted = true
+	} else {
+		if from < 0 {
+			dc.n++
+			from = 0
+		}
+		if to < 0 {
+			dc.n--
+			to = 0
+		}
+		dc.size += to - from
+	}
+	if !dc.within() {
+		dc.evict(key)
+	}
+}
+
+// within tells if the counted entries are within the cache bounds
+func (dc *DiskCache) within() bool {
+	return (dc.MaxEntries <= 0 || dc.n <= dc.MaxEntries) &&
+		(dc.MaxBytes <= 0 || dc.size <= dc.MaxBytes)
+}
+
+// evict removes the least recently accessed entries, other than
+// the one with the given key, until the cache is within its bounds.
+// The entry files are counted anew, to see those of other processes.
+func (dc *DiskCache) evict(keep string) {
+	type entryFile struct {
+		key   string
+		size  int64
+		mtime time.Time
+	}
+	var files []entryFile
+	dc.n, dc.size = 0, 0
+	dc.walk(func(key string, info fs.FileInfo) {
+		files = append(files, entryFile{key, info.Size(), info.ModTime()})
+		dc.n++
+		dc.size += info.Size()
+	})
+	dc.counted = true
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].mtime.Before(files[j].mtime)
+	})
+
+	evicted := 0
+	for _, f := range files {
+		if dc.within() {
+			break
+		}
+		if f.key == keep {
+			continue
+		}
+		if err := os.Remove(dc.path(f.key)); err != nil && !os.IsNotExist(err) {
+			continue
+		}
+		dc.n--
+		dc.size -= f.size
+		evicted++
+	}
+	logging.Debug("Evicted cache entries", logging.F("count", evicted))
+}
+
+// Range calls fn for each entry, until it returns false.
+// Unlike Get, it does not count as an access to the entries.
+func (dc *DiskCache) Range(fn func(key string, value client.Payload) bool) {
+	filepath.WalkDir(dc.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		value, found := dc.read(d.Name())
+		if found && !fn(d.Name(), value) {
+			return fs.SkipAll
+		}
+		return nil
+	})
+}
+
+// LastAccess returns the time the entry with the given key was last
+// set or got, i.e. the modification time of its file
+func (dc *DiskCache) LastAccess(key string) (time.Time, bool) {
+	info, err := os.Stat(dc.path(key))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return info.ModTime(), true
+}
+
+// Len returns the number of entries in the cache
+func (dc *DiskCache) Len() int {
+	n, _ := dc.count()
+	return n
+}
+
+// Bytes returns the size of the entry files
+func (dc *DiskCache) Bytes() int64 {
+	_, size := dc.count()
+	return size
+}
+
+// count returns the number and total size of the entry files
+func (dc *DiskCache) count() (int, int64) {
+	var (
+		n    int
+		size int64
+	)
+	dc.walk(func(key string, info fs.FileInfo) {
+		n++
+		size += info.Size()
+	})
+	return n, size
+}
+
+// walk calls fn for each entry file
+func (dc *DiskCache) walk(fn func(key string, info fs.FileInfo)) {
+	filepath.WalkDir(dc.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			fn(d.Name(), info)
+		}
+		return nil
+	})
+}
+
+// staleTempAge is the age from which temporary files are considered
+// left over by interrupted writes, rather than being written
+const staleTempAge = time.Hour
+
+// Compact removes the temporary files left over by interrupted writes
+// (older than staleTempAge, so as to leave alone those of processes
+// sharing the directory) and the empty directories, after evicting the
+// least recently accessed entries if the cache is beyond its bounds
+func (dc *DiskCache) Compact() error {
+	if dc.MaxEntries > 0 || dc.MaxBytes > 0 {
+		dc.mu.Lock()
+		dc.evict("")
+		dc.mu.Unlock()
+	}
+
+	var dirs []string
+	err := filepath.WalkDir(dc.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dc.Dir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		if !strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && time.Since(info.ModTime()) > staleTempAge {
+			return os.Remove(path)
+		}
+		return nil
+	})
+
+	for _, dir := range dirs {
+		// fails, as wanted, for non-empty directories
+		os.Remove(dir)
+	}
+	return err
+}
+
+// Close is a no-op, entries are written as they are set
+func (dc *DiskCache) Close() error {
+	return nil
+}
@@ -0,0 +1,250 @@
+package cachedclient
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/brinick/github/client"
+	"github.com/brinick/logging"
+)
+
+// dependency maps the API paths matching a pattern to the paths of
+// further resources whose cached responses a write makes stale: those
+// of the resources below given paths, or of given collections (with
+// any query string, and where a * path segment matches any segment).
+// Paths are expanded with the pattern submatches.
+type dependency struct {
+	pattern  *regexp.Regexp
+	prefixes []string
+	lists    []string
+}
+
+// dependencies are the non-hierarchical relations between resources.
+// Writes also invalidate the resource written and, for items, the
+// collection they belong to (see invalidateAfterWrite).
+var dependencies = []dependency{
+	{
+		// statuses are created at /statuses/:sha but listed under /commits/:sha
+		pattern:  regexp.MustCompile(`^/repos/([^/]+)/([^/]+)/statuses/([^/]+)$`),
+		prefixes: []string{"/repos/$1/$2/commits/$3"},
+	},
+	{
+		// comments are edited by ID but listed for their issue, and
+		// for the whole repo
+		pattern: regexp.MustCompile(`^/repos/([^/]+)/([^/]+)/issues/comments/`),
+		lists:   []string{"/repos/$1/$2/issues/comments", "/repos/$1/$2/issues/*/comments"},
+	},
+	{
+		// pull requests are issues, and vice versa
+		pattern:  regexp.MustCompile(`^/repos/([^/]+)/([^/]+)/pulls/(\d+)`),
+		prefixes: []string{"/repos/$1/$2/issues/$3"},
+		lists:    []string{"/repos/$1/$2/pulls", "/repos/$1/$2/issues"},
+	},
+	{
+		pattern:  regexp.MustCompile(`^/repos/([^/]+)/([^/]+)/issues/(\d+)`),
+		prefixes: []string{"/repos/$1/$2/pulls/$3"},
+		lists:    []string{"/repos/$1/$2/pulls"},
+	},
+	{
+		pattern:  regexp.MustCompile(`^/repos/([^/]+)/([^/]+)/git/refs/heads/(.+)$`),
+		prefixes: []string{"/repos/$1/$2/branches/$3"},
+		lists:    []string{"/repos/$1/$2/branches"},
+	},
+	{
+		pattern: regexp.MustCompile(`^/user/starred/`),
+		lists:   []string{"/user/starred"},
+	},
+	{
+		// memberships (of teams, whatever their URL, or of orgs) are
+		// written by login, but listed as members
+		pattern: regexp.MustCompile(`^(.+)/memberships/[^/]+$`),
+		lists:   []string{"$1", "$1/members"},
+	},
+}
+
+// ---------------------------------------------------------------
+
+// Invalidate removes the cached responses to the GETs of the given
+// URL prefix, i.e. of the URL itself (with any query string) and of
+// the URLs below it. It returns the number of responses removed.
+// Responses cached before URLs were stored in the cache are kept.
+func (c *PickledCachedClient) Invalidate(prefix string) int {
+	return c.invalidate([]string{prefix}, nil)
+}
+
+// invalidateAfterWrite removes the cached responses made stale by
+// a successful write to the given URL: those of the URL itself and
+// the URLs below it, of its parent (the collection containing it or,
+// if it is a collection created into, its parent item) but not of the
+// parent's other children, and of its dependencies
+func (c *PickledCachedClient) invalidateAfterWrite(method, url string) {
+	url = strings.SplitN(url, "?", 2)[0]
+	prefixes := []string{url}
+	var exact []string
+
+	base := strings.TrimSuffix(c.APIURL, "/")
+	if path := strings.TrimPrefix(url, base); path != url {
+		if i := strings.LastIndex(path, "/"); i > 0 {
+			exact = append(exact, base+path[:i])
+		}
+
+		for _, dep := range dependencies {
+			match := dep.pattern.FindStringSubmatchIndex(path)
+			if match == nil {
+				continue
+			}
+			expand := func(tpl string) string {
+				return base + string(dep.pattern.ExpandString(nil, tpl, path, match))
+			}
+			for _, tpl := range dep.prefixes {
+				prefixes = append(prefixes, expand(tpl))
+			}
+			for _, tpl := range dep.lists {
+				exact = append(exact, expand(tpl))
+			}
+		}
+	}
+
+	n := c.invalidate(prefixes, exact)
+	if n > 0 {
+		logging.Debug(
+			"Invalidated cached responses",
+			logging.F("method", method),
+			logging.F("url", url),
+			logging.F("count", n),
+		)
+	}
+}
+
+// invalidate removes the cached responses to the GETs of the given URL
+// prefixes, and of the given collections (see dependency.lists)
+func (c *PickledCachedClient) invalidate(prefixes, exact []string) int {
+	n := 0
+	for url, keys := range c.index.match(c.cache, prefixes, exact) {
+		for _, key := range keys {
+			c.cacheDelete(key, url)
+			n++
+		}
+	}
+	return n
+}
+
+// cacheSet caches the response, indexing it by URL
+func (c *PickledCachedClient) cacheSet(key string, value client.Payload) {
+	c.cache.Set(key, value)
+	c.index.add(value.URL, key)
+}
+
+// cacheDelete removes the cached response to the GET of the URL
+func (c *PickledCachedClient) cacheDelete(key, url string) {
+	c.cache.Delete(key)
+	c.index.remove(url, key)
+}
+
+// ---------------------------------------------------------------
+
+// urlIndex maps the URLs (without query string) of the cached responses
+// to their keys, so that invalidating does not go over the whole cache
+// (and decode every entry of a DiskCache) on every write. It is built
+// from the cache when first used, then kept up to date by the client:
+// responses cached since by other processes sharing the cache are not
+// invalidated.
+type urlIndex struct {
+	mu    sync.Mutex
+	built bool
+	keys  map[string]map[string]bool
+}
+
+func (x *urlIndex) add(url, key string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.built && url != "" {
+		x.addLocked(url, key)
+	}
+}
+
+func (x *urlIndex) addLocked(url, key string) {
+	url = strings.SplitN(url, "?", 2)[0]
+	if x.keys[url] == nil {
+		x.keys[url] = map[string]bool{}
+	}
+	x.keys[url][key] = true
+}
+
+func (x *urlIndex) remove(url, key string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	url = strings.SplitN(url, "?", 2)[0]
+	if keys := x.keys[url]; keys != nil {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(x.keys, url)
+		}
+	}
+}
+
+// match returns the keys of the cached responses, by URL, of the given
+// URL prefixes and collections, building the index if need be
+func (x *urlIndex) match(cache Cache, prefixes, exact []string) map[string][]string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if !x.built {
+		x.keys = map[string]map[string]bool{}
+		cache.Range(func(key string, value client.Payload) bool {
+			if value.URL != "" {
+				x.addLocked(value.URL, key)
+			}
+			return true
+		})
+		x.built = true
+	}
+
+	matches := map[string][]string{}
+	for url, keys := range x.keys {
+		matched := false
+		for _, prefix := range prefixes {
+			matched = matched || HasURLPrefix(url, prefix)
+		}
+		for _, list := range exact {
+			matched = matched || matchList(url, list)
+		}
+		if !matched {
+			continue
+		}
+		for key := range keys {
+			matches[url] = append(matches[url], key)
+		}
+	}
+	return matches
+}
+
+// matchList tells if the URL (without query string) is that of the
+// collection, a * path segment of which matches any segment
+func matchList(url, list string) bool {
+	if !strings.Contains(list, "*") {
+		return url == list
+	}
+	urlSegments, listSegments := strings.Split(url, "/"), strings.Split(list, "/")
+	if len(urlSegments) != len(listSegments) {
+		return false
+	}
+	for i, segment := range listSegments {
+		if segment != "*" && segment != urlSegments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// HasURLPrefix tells if the URL is the prefix URL, or below it
+// (ignoring a trailing slash of the prefix)
+func HasURLPrefix(url, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if !strings.HasPrefix(url, prefix) {
+		return false
+	}
+	rest := url[len(prefix):]
+	return rest == "" || rest[0] == '/' || rest[0] == '?'
+}
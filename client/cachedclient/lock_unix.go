@@ -0,0 +1,38 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package cachedclient
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an advisory lock on the file at the given path,
+// created if need be, returning the function releasing the lock.
+// The lock is exclusive or shared, and blocks until taken.
+func lockFile(path string, exclusive bool) (func(), error) {
+	handler, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		err = syscall.Flock(int(handler.Fd()), how)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		handler.Close()
+		return nil, err
+	}
+
+	return func() {
+		syscall.Flock(int(handler.Fd()), syscall.LOCK_UN)
+		handler.Close()
+	}, nil
+}
@@ -0,0 +1,126 @@
+package cachedclient
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/brinick/github/client"
+)
+
+// MemoryCache is an in-memory cache evicting the least recently
+// used entries beyond a maximum number of entries or bytes.
+// It is safe for concurrent use.
+type MemoryCache struct {
+	// MaxEntries and MaxBytes bound the number and size of the stored
+	// payloads (zero or less: no bound). Set them before use.
+	MaxEntries int
+	MaxBytes   int64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // front: most recently used
+	bytes   int64
+}
+
+type memoryEntry struct {
+	key   string
+	value client.Payload
+}
+
+// NewMemoryCache creates an empty, unbounded in-memory cache
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// Get returns the payload stored under the given key, if any
+func (mc *MemoryCache) Get(key string) (client.Payload, bool) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	elem, found := mc.entries[key]
+	if !found {
+		return client.Payload{}, false
+	}
+	mc.lru.MoveToFront(elem)
+	return elem.Value.(*memoryEntry).value, true
+}
+
+// Set stores the payload under the given key, evicting the
+// least recently used entry if the cache is full
+func (mc *MemoryCache) Set(key string, value client.Payload) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if elem, found := mc.entries[key]; found {
+		entry := elem.Value.(*memoryEntry)
+		mc.bytes += payloadSize(value) - payloadSize(entry.value)
+		entry.value = value
+		mc.lru.MoveToFront(elem)
+	} else {
+		mc.entries[key] = mc.lru.PushFront(&memoryEntry{key, value})
+		mc.bytes += payloadSize(value)
+	}
+
+	for mc.lru.Len() > 1 &&
+		((mc.MaxEntries > 0 && mc.lru.Len() > mc.MaxEntries) ||
+			(mc.MaxBytes > 0 && mc.bytes > mc.MaxBytes)) {
+		mc.remove(mc.lru.Back())
+	}
+	return nil
+}
+
+// Delete removes the payload stored under the given key
+func (mc *MemoryCache) Delete(key string) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if elem, found := mc.entries[key]; found {
+		mc.remove(elem)
+	}
+	return nil
+}
+
+func (mc *MemoryCache) remove(elem *list.Element) {
+	entry := mc.lru.Remove(elem).(*memoryEntry)
+	delete(mc.entries, entry.key)
+	mc.bytes -= payloadSize(entry.value)
+}
+
+// Range calls fn for each entry, from the most recently used,
+// until it returns false
+func (mc *MemoryCache) Range(fn func(key string, value client.Payload) bool) {
+	mc.mu.Lock()
+	entries := make([]memoryEntry, 0, mc.lru.Len())
+	for elem := mc.lru.Front(); elem != nil; elem = elem.Next() {
+		entries = append(entries, *elem.Value.(*memoryEntry))
+	}
+	mc.mu.Unlock()
+
+	for _, entry := range entries {
+		if !fn(entry.key, entry.value) {
+			return
+		}
+	}
+}
+
+// Len returns the number of entries in the cache
+func (mc *MemoryCache) Len() int {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.lru.Len()
+}
+
+// Bytes returns the size of the stored payloads
+func (mc *MemoryCache) Bytes() int64 {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.bytes
+}
+
+// Close is a no-op, the cache is not persisted
+func (mc *MemoryCache) Close() error {
+	return nil
+}
@@ -0,0 +1,94 @@
+package cachedclient
+
+import (
+	"net/http"
+
+	"github.com/brinick/github/client"
+)
+
+// NetworkMode sets when a client contacts Github
+type NetworkMode int
+
+const (
+	// Online clients validate cached responses with conditional GETs
+	Online NetworkMode = iota
+
+	// Offline clients never contact Github. GETs are answered from the
+	// cache (pagination included, via the stored next page links), or
+	// fail with client.ErrOffline. Writes fail with client.ErrOffline.
+	Offline
+
+	// OfflineFallback clients work online, but answer GETs from the
+	// cache when Github is unreachable, failing (5xx) or rate limiting
+	OfflineFallback
+)
+
+func (m NetworkMode) String() string {
+	switch m {
+	case Online:
+		return "online"
+	case Offline:
+		return "offline"
+	case OfflineFallback:
+		return "offline-fallback"
+	}
+	return "unknown"
+}
+
+// ---------------------------------------------------------------
+
+// NetworkMode returns the current network mode of the client
+func (c *PickledCachedClient) NetworkMode() NetworkMode {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mode
+}
+
+// SetNetworkMode changes the network mode of the client,
+// e.g. to go offline once Github is known to be down
+func (c *PickledCachedClient) SetNetworkMode(m NetworkMode) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mode = m
+}
+
+// stalePage returns a page with the response cached under the given
+// key (or, as by older versions, under the URL only), without validating
+// it with Github, or a page with the given error if there is none.
+// The sent flag tells if a request was sent.
+func (c *PickledCachedClient) stalePage(url, key string, missErr error, sent bool) *client.Page {
+	value, found := c.cache.Get(key)
+	if !found {
+		value, found = c.cache.Get(URLKey(url))
+	}
+	if !found {
+		return &client.Page{URL: url, Err: missErr}
+	}
+	if value.URL == "" {
+		value.URL = url
+	}
+
+	c.mu.Lock()
+	c.stats.Stale++
+	if !sent {
+		c.stats.RequestsSaved++
+	}
+	c.mu.Unlock()
+
+	return &client.Page{
+		URL:        url,
+		Content:    &value,
+		StatusCode: http.StatusOK,
+		Stale:      true,
+	}
+}
+
+// unavailable tells if the response shows that Github cannot
+// currently answer the request, which may then be served stale
+func unavailable(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		return client.CheckRateLimit(resp.StatusCode, resp.Header, readBody(resp)) != nil
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
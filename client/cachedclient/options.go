@@ -0,0 +1,153 @@
+package cachedclient
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/brinick/github"
+	"github.com/brinick/github/authorisation"
+)
+
+// Option configures a PickledCachedClient at construction time
+type Option func(*PickledCachedClient)
+
+// WithToken sets the token retriever used to authorise requests,
+// instead of the default chain of token sources of the API host
+func WithToken(tr authorisation.TokenRetriever) Option {
+	return func(c *PickledCachedClient) {
+		c.APIToken = tr
+	}
+}
+
+// WithBaseURL sets the REST API base URL, e.g. https://ghe.example.com/api/v3
+// for a Github Enterprise Server. The uploads and GraphQL URLs are derived
+// from it (see github.NewAPI), unless set explicitly afterwards.
+func WithBaseURL(baseURL string) Option {
+	return WithAPI(github.NewAPI(baseURL))
+}
+
+// WithAPI sets the REST, uploads and GraphQL API URLs
+func WithAPI(api github.API) Option {
+	return func(c *PickledCachedClient) {
+		c.APIURL = api.URL
+		c.UploadsURL = api.UPLOADS
+		c.GraphQLURL = api.GRAPHQL
+	}
+}
+
+// WithUploadsURL sets the uploads API URL
+func WithUploadsURL(uploadsURL string) Option {
+	return func(c *PickledCachedClient) {
+		c.UploadsURL = uploadsURL
+	}
+}
+
+// WithGraphQLURL sets the GraphQL API URL
+func WithGraphQLURL(graphQLURL string) Option {
+	return func(c *PickledCachedClient) {
+		c.GraphQLURL = graphQLURL
+	}
+}
+
+// WithCache sets the cache used to store the ETag'd GET payloads,
+// e.g. a MemoryCache for tests or short-lived programs, or a
+// DiskCache for long-running ones (default: a PickledCache)
+func WithCache(cache Cache) Option {
+	return func(c *PickledCachedClient) {
+		c.cache = cache
+	}
+}
+
+// WithCacheFile uses a cache stored in the file at the given path,
+// instead of the one given by the GITHUB_CACHE_FILE env var
+func WithCacheFile(path string) Option {
+	return func(c *PickledCachedClient) {
+		c.cache, _ = NewCacheAt(path)
+	}
+}
+
+// WithRateLimitWait makes the client block, for at most the given duration,
+// until a hit rate limit is lifted and then retry the request. Requests
+// hitting a limit that lasts longer fail with a *client.RateLimitError.
+// By default the client does not wait.
+func WithRateLimitWait(max time.Duration) Option {
+	return func(c *PickledCachedClient) {
+		c.rateLimitWait = max
+	}
+}
+
+// WithRateLimitCallback sets a function called every time a request
+// hits a rate limit, e.g. to log that the client is being throttled
+func WithRateLimitCallback(cb RateLimitCallback) Option {
+	return func(c *PickledCachedClient) {
+		c.onRateLimit = cb
+	}
+}
+
+// WithRetryPolicy sets how requests failing for transient reasons
+// are retried (default: DefaultRetryPolicy)
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *PickledCachedClient) {
+		c.retry = p
+	}
+}
+
+// WithTransport sets the base HTTP transport used to send requests
+// (default: http.DefaultTransport), e.g. a cassette.Cassette
+// to record or replay interactions
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *PickledCachedClient) {
+		c.transport.base = rt
+	}
+}
+
+// WithHTTPClient bases the client's HTTP client on a copy of the given
+// one, e.g. to reuse its cookie jar or redirect policy. Its transport
+// is used as base transport, unless WithTransport is also given.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *PickledCachedClient) {
+		c.transport.httpClient = hc
+	}
+}
+
+// WithTimeout sets the time limit for each HTTP request, including
+// reading the response body (default: no limit)
+func WithTimeout(d time.Duration) Option {
+	return func(c *PickledCachedClient) {
+		c.transport.timeout = d
+	}
+}
+
+// WithProxy sets the function returning the proxy to use for
+// a request (default: http.ProxyFromEnvironment), e.g. http.ProxyURL
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(c *PickledCachedClient) {
+		c.transport.proxy = proxy
+	}
+}
+
+// WithTLSConfig sets the TLS configuration, e.g. to trust the
+// CA of a Github Enterprise Server with a private certificate
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *PickledCachedClient) {
+		c.transport.tlsConfig = cfg
+	}
+}
+
+// WithMiddleware wraps the transport with the given middlewares, for
+// tracing, logging or header injection. The first one given is the
+// outermost, i.e. it sees each request first and each response last.
+func WithMiddleware(mws ...Middleware) Option {
+	return func(c *PickledCachedClient) {
+		c.transport.middlewares = append(c.transport.middlewares, mws...)
+	}
+}
+
+// WithNetworkMode sets when the client contacts Github (default: Online)
+func WithNetworkMode(m NetworkMode) Option {
+	return func(c *PickledCachedClient) {
+		c.mode = m
+	}
+}
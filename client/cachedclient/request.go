@@ -0,0 +1,252 @@
+package cachedclient
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/brinick/github/authorisation"
+	"github.com/brinick/github/client"
+	"github.com/brinick/logging"
+)
+
+// RateLimitCallback is called when a request hits a Github rate limit,
+// with the time the client will wait before retrying the request
+// (zero if it will not wait, in which case the request fails).
+type RateLimitCallback func(url string, err *client.RateLimitError, wait time.Duration)
+
+// ---------------------------------------------------------------
+
+// RateLimit returns the rate limit state reported
+// by the last response received by the client
+func (c *PickledCachedClient) RateLimit() client.RateLimit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rate
+}
+
+func (c *PickledCachedClient) updateRateLimit(rl client.RateLimit) {
+	if !rl.Known() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rate = rl
+}
+
+// observeRate notifies the token retriever, if it tracks the quota
+// of its tokens, of the rate limit state of the token used
+func (c *PickledCachedClient) observeRate(headers map[string]string, rl client.RateLimit) {
+	observer, ok := c.APIToken.(authorisation.RateObserver)
+	if !ok || !rl.Known() {
+		return
+	}
+	calls := authorisation.APICalls{Remaining: rl.Remaining, Limit: rl.Limit, Reset: rl.Reset}
+	observer.ObserveRate(requestToken(headers), calls)
+}
+
+// rotateToken returns another token to use in place of that of the
+// request hitting the primary rate limit, if the retriever has one
+func (c *PickledCachedClient) rotateToken(headers map[string]string, rle *client.RateLimitError) (string, bool) {
+	rotator, ok := c.APIToken.(authorisation.TokenRotator)
+	if !ok || rle.Secondary {
+		return "", false
+	}
+	return rotator.Rotate(requestToken(headers))
+}
+
+// requestToken returns the token of the request with the given headers
+func requestToken(headers map[string]string) string {
+	return strings.TrimPrefix(headers["Authorization"], "token ")
+}
+
+// withToken returns a copy of the headers, authorising with the given token
+func withToken(headers map[string]string, token string) map[string]string {
+	copied := make(map[string]string, len(headers))
+	for key, val := range headers {
+		copied[key] = val
+	}
+	copied["Authorization"] = "token " + token
+	return copied
+}
+
+// maxRateLimitRetries is the number of times a rate limited request is
+// retried, with another token or once the limit is lifted, before failing
+const maxRateLimitRetries = 3
+
+// ---------------------------------------------------------------
+
+// do executes an HTTP request with the given method, URL, body and headers,
+// returning the response and the number of times the request was sent.
+// Transient failures are retried according to the client's retry policy.
+// Every response updates the client's rate limit state. If the request
+// hits the primary rate limit and the token retriever has another token
+// (see authorisation.TokenRotator) not yet tried for the request, it is
+// retried with that one. Else if the client is configured to wait for the
+// limit, the request is retried once the limit is lifted (or the context
+// is done). Rate limited requests are retried up to maxRateLimitRetries
+// times in all.
+// The caller must close the body of the returned response.
+func (c *PickledCachedClient) do(
+	ctx context.Context,
+	method, url string,
+	body []byte,
+	headers map[string]string,
+) (*http.Response, int, error) {
+
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+
+	attempts, failures, limited := 0, 0, 0
+	tried := map[string]bool{requestToken(headers): true}
+	for {
+		attempts++
+		resp, err := c.send(ctx, method, url, body, headers)
+
+		if err != nil || c.retry.isRetryableStatus(resp.StatusCode) {
+			failures++
+			if !c.retry.shouldRetry(ctx, method, failures, resp, err) {
+				return resp, attempts, err
+			}
+
+			delay := c.retry.backoff(failures, resp)
+			if resp != nil {
+				resp.Body.Close()
+			}
+			logging.Info(
+				"Transient failure, retrying",
+				logging.F("method", method),
+				logging.F("url", url),
+				logging.F("err", err),
+				logging.F("delay", delay),
+			)
+
+			if err := sleep(ctx, delay); err != nil {
+				return nil, attempts, err
+			}
+			continue
+		}
+
+		rl := client.ParseRateLimit(resp.Header)
+		c.updateRateLimit(rl)
+		c.observeRate(headers, rl)
+
+		if resp.StatusCode != http.StatusForbidden &&
+			resp.StatusCode != http.StatusTooManyRequests {
+			return resp, attempts, nil
+		}
+
+		rle := client.CheckRateLimit(resp.StatusCode, resp.Header, readBody(resp))
+		if rle == nil {
+			return resp, attempts, nil
+		}
+
+		if limited == maxRateLimitRetries {
+			c.notifyRateLimit(url, rle, 0)
+			return resp, attempts, nil
+		}
+		limited++
+
+		if token, ok := c.rotateToken(headers, rle); ok && !tried[token] {
+			tried[token] = true
+			resp.Body.Close()
+			headers = withToken(headers, token)
+			logging.Info("Rate limited, retrying with another token", logging.F("url", url))
+			continue
+		}
+
+		wait := rle.Wait(time.Now())
+		if c.rateLimitWait == 0 || wait > c.rateLimitWait {
+			// not allowed to wait (that long)
+			c.notifyRateLimit(url, rle, 0)
+			return resp, attempts, nil
+		}
+
+		resp.Body.Close()
+		c.notifyRateLimit(url, rle, wait)
+		logging.Info(
+			"Rate limited, waiting before retrying",
+			logging.F("url", url),
+			logging.F("wait", wait),
+			logging.F("secondary", rle.Secondary),
+		)
+
+		if err := sleep(ctx, wait); err != nil {
+			return nil, attempts, err
+		}
+	}
+}
+
+// send executes a single HTTP request
+func (c *PickledCachedClient) send(
+	ctx context.Context,
+	method, url string,
+	body []byte,
+	headers map[string]string,
+) (*http.Response, error) {
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, val := range headers {
+		req.Header.Set(key, val)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+func (c *PickledCachedClient) notifyRateLimit(
+	url string,
+	rle *client.RateLimitError,
+	wait time.Duration,
+) {
+	if c.onRateLimit != nil {
+		c.onRateLimit(url, rle, wait)
+	}
+}
+
+// newAPIError creates the error corresponding to the given
+// unsuccessful response, to the request with the given method and URL
+func newAPIError(method, url string, resp *http.Response) *client.APIError {
+	body := readBody(resp)
+	e := client.NewAPIError(method, url, resp.StatusCode, body)
+	if rle := client.CheckRateLimit(resp.StatusCode, resp.Header, body); rle != nil {
+		e.Err = rle
+	}
+	return e
+}
+
+// readBody reads the whole response body, replacing it with an in-memory
+// copy so that it may be read again. Errors yield an empty body.
+func readBody(resp *http.Response) []byte {
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		logging.Error("Unable to read HTTP response body", logging.F("err", err))
+	}
+	return data
+}
+
+// sleep waits for the given duration, or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
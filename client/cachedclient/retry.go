@@ -0,0 +1,118 @@
+package cachedclient
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/brinick/github/client"
+)
+
+// RetryPolicy defines how requests failing for transient reasons
+// (connection errors, 502/503/504 responses...) are retried
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a request failing for
+	// transient reasons is sent, including the first one. Values below 2
+	// disable retries. Retries on rate limits, with another token or
+	// once the limit is lifted, are not counted.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry, doubled for every
+	// subsequent one up to MaxDelay. Random jitter is applied to each.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// RetryableStatus lists the HTTP status codes considered transient
+	RetryableStatus []int
+
+	// RetryNonIdempotent allows POST and PATCH requests to be replayed.
+	// By default they are not, as Github may have acted on the
+	// first request despite the failure.
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy is the retry policy used by clients by default
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+	RetryableStatus: []int{
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+}
+
+// NoRetryPolicy disables retries
+var NoRetryPolicy = RetryPolicy{}
+
+// ---------------------------------------------------------------
+
+// isIdempotent indicates if an HTTP method may be safely replayed
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+func (p RetryPolicy) isRetryableStatus(statusCode int) bool {
+	for _, code := range p.RetryableStatus {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldRetry indicates if a request with the given method, having been sent
+// the given number of times, should be sent again given its response or error
+func (p RetryPolicy) shouldRetry(
+	ctx context.Context,
+	method string,
+	attempts int,
+	resp *http.Response,
+	err error,
+) bool {
+
+	if attempts >= p.MaxAttempts || ctx.Err() != nil {
+		return false
+	}
+
+	if !isIdempotent(method) && !p.RetryNonIdempotent {
+		return false
+	}
+
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return p.isRetryableStatus(resp.StatusCode)
+}
+
+// backoff returns the delay before the given retry (1 for the first),
+// exponentially increasing, with jitter. A Retry-After header in the
+// failed response is honoured if it asks for a longer delay.
+func (p RetryPolicy) backoff(retry int, resp *http.Response) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < retry && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	// "equal jitter": half fixed, half random
+	if half := int64(delay / 2); half > 0 {
+		delay = time.Duration(half + rand.Int63n(half))
+	}
+
+	if resp != nil {
+		if after := client.ParseRateLimit(resp.Header).RetryAfter; after > delay {
+			delay = after
+		}
+	}
+	return delay
+}
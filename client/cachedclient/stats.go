@@ -0,0 +1,53 @@
+package cachedclient
+
+// CacheStats reports how much a client's cache saved it
+type CacheStats struct {
+	// Hits is the number of GETs answered from the cache,
+	// after a 304 Not Modified response
+	Hits int
+
+	// Misses is the number of GETs answered with fresh content
+	Misses int
+
+	// Stale is the number of GETs answered from the cache without
+	// validation, when offline or as Github was unavailable
+	Stale int
+
+	// Entries and Bytes give the cache size, or -1
+	// if the cache is not a CacheSizer
+	Entries int
+	Bytes   int64
+
+	// RequestsSaved is the number of requests not counted against
+	// the rate limit thanks to the cache: Github does not count
+	// 304 responses to authorised conditional requests, and offline
+	// clients send no requests
+	RequestsSaved int
+}
+
+// Stats returns the cache statistics of the client
+func (c *PickledCachedClient) Stats() CacheStats {
+	c.mu.Lock()
+	stats := c.stats
+	c.mu.Unlock()
+
+	stats.Entries, stats.Bytes = -1, -1
+	if sizer, ok := c.cache.(CacheSizer); ok {
+		stats.Entries = sizer.Len()
+		stats.Bytes = sizer.Bytes()
+	}
+	return stats
+}
+
+func (c *PickledCachedClient) recordCacheHit() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Hits++
+	c.stats.RequestsSaved++
+}
+
+func (c *PickledCachedClient) recordCacheMiss() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Misses++
+}
@@ -0,0 +1,126 @@
+package cachedclient
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/brinick/logging"
+)
+
+// Middleware wraps the HTTP transport of a client, e.g. to add
+// tracing, logging or headers to every request and response
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts a function to the http.RoundTripper interface
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req)
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// ---------------------------------------------------------------
+
+// transportConfig gathers the options from which
+// the client's long-lived http.Client is built
+type transportConfig struct {
+	base        http.RoundTripper
+	httpClient  *http.Client
+	timeout     time.Duration
+	proxy       func(*http.Request) (*url.URL, error)
+	tlsConfig   *tls.Config
+	middlewares []Middleware
+}
+
+// build creates the http.Client. The proxy and TLS settings
+// apply to the default transport, or to the given base transport
+// if it is an *http.Transport (which is then cloned).
+func (tc transportConfig) build() *http.Client {
+	httpClient := &http.Client{}
+	if tc.httpClient != nil {
+		copied := *tc.httpClient
+		httpClient = &copied
+	}
+
+	base := tc.base
+	if base == nil {
+		base = httpClient.Transport
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if tc.proxy != nil || tc.tlsConfig != nil {
+		if t, ok := base.(*http.Transport); ok {
+			t = t.Clone()
+			if tc.proxy != nil {
+				t.Proxy = tc.proxy
+			}
+			if tc.tlsConfig != nil {
+				t.TLSClientConfig = tc.tlsConfig
+			}
+			base = t
+		} else {
+			logging.Error("Proxy and TLS options ignored for a custom, non *http.Transport transport")
+		}
+	}
+
+	// the first middleware is the outermost
+	rt := base
+	for i := len(tc.middlewares) - 1; i >= 0; i-- {
+		rt = tc.middlewares[i](rt)
+	}
+
+	httpClient.Transport = rt
+	if tc.timeout > 0 {
+		httpClient.Timeout = tc.timeout
+	}
+	return httpClient
+}
+
+// ---------------------------------------------------------------
+
+// SetHeader returns a middleware setting the given
+// header on every request, e.g. a custom User-Agent
+func SetHeader(key, value string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			// a RoundTripper should not modify the request
+			req = req.Clone(req.Context())
+			req.Header.Set(key, value)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// LogRequests returns a middleware logging (at debug level)
+// every request with its status code and duration
+func LogRequests() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+
+			if err != nil {
+				logging.Debug(
+					"HTTP request failed",
+					logging.F("method", req.Method),
+					logging.F("url", req.URL.String()),
+					logging.F("duration", time.Since(start)),
+					logging.F("err", err),
+				)
+			} else {
+				logging.Debug(
+					"HTTP request",
+					logging.F("method", req.Method),
+					logging.F("url", req.URL.String()),
+					logging.F("duration", time.Since(start)),
+					logging.F("statuscode", resp.StatusCode),
+				)
+			}
+			return resp, err
+		})
+	}
+}
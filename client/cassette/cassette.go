@@ -0,0 +1,287 @@
+// Package cassette records the HTTP interactions of a client with the
+// Github API into a JSON file (a "cassette"), and replays them later
+// without network access. A cassette is an http.RoundTripper, to be
+// used as the transport of a client:
+//
+//	cas, _ := cassette.New("testdata/issues.json", cassette.ModeReplay)
+//	c := cachedclient.NewClient(cachedclient.WithTransport(cas))
+//
+// Recording is best done with an empty client cache: conditional
+// requests answered with 304 replay poorly into a fresh cache.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Mode is the mode of operation of a cassette
+type Mode int
+
+const (
+	// ModeRecord sends requests to the network, recording
+	// each request/response pair in the cassette
+	ModeRecord Mode = iota
+
+	// ModeReplay serves responses from the cassette,
+	// never touching the network
+	ModeReplay
+
+	// ModeAuto replays the cassette if its file exists,
+	// and records it otherwise
+	ModeAuto
+)
+
+// Redacted replaces the value of redacted headers in recorded requests
+const Redacted = "REDACTED"
+
+// ErrNoInteraction is returned (wrapped) when replaying
+// a request that the cassette has no response for
+var ErrNoInteraction = errors.New("No recorded interaction for request")
+
+// ------------------------------------------------------------------
+
+// Request is a recorded HTTP request
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// Response is a recorded HTTP response
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Interaction is a recorded request/response pair
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// ------------------------------------------------------------------
+
+// Cassette records or replays HTTP interactions
+type Cassette struct {
+	Path         string
+	Mode         Mode
+	Interactions []*Interaction
+
+	// Transport is used to send requests when recording
+	// (default: http.DefaultTransport)
+	Transport http.RoundTripper
+
+	// RedactHeaders lists the request headers whose values are
+	// not recorded (default: Authorization)
+	RedactHeaders []string
+
+	mu     sync.Mutex
+	played []bool
+}
+
+// New creates a cassette stored at the given path. In replay mode,
+// the recorded interactions are loaded from the file. In record mode,
+// any previous recording is overwritten.
+func New(path string, mode Mode) (*Cassette, error) {
+	if mode == ModeAuto {
+		mode = ModeRecord
+		if exists(path) {
+			mode = ModeReplay
+		}
+	}
+
+	c := &Cassette{
+		Path:          path,
+		Mode:          mode,
+		RedactHeaders: []string{"Authorization"},
+	}
+
+	if mode == ModeReplay {
+		if err := c.Load(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Load reads the recorded interactions from the cassette file
+func (c *Cassette) Load() error {
+	data, err := ioutil.ReadFile(c.Path)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Interactions = nil
+	if err := json.Unmarshal(data, &c.Interactions); err != nil {
+		return fmt.Errorf("Unable to decode cassette %s: %w", c.Path, err)
+	}
+	c.played = make([]bool, len(c.Interactions))
+	return nil
+}
+
+// Save writes the recorded interactions to the cassette file
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.save()
+}
+
+func (c *Cassette) save() error {
+	data, err := json.MarshalIndent(c.Interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.Path, data, 0644)
+}
+
+// ------------------------------------------------------------------
+
+// RoundTrip records or replays the request, depending on the mode
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Mode == ModeReplay {
+		return c.replay(req, body)
+	}
+	return c.record(req, body)
+}
+
+// record sends the request, saving the interaction in the cassette
+// (and the cassette to file) once the response has been received
+func (c *Cassette) record(req *http.Request, body []byte) (*http.Response, error) {
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	interaction := &Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: c.redact(req.Header),
+			Body:   string(body),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header.Clone(),
+			Body:       string(respBody),
+		},
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Interactions = append(c.Interactions, interaction)
+	c.played = append(c.played, true)
+	if err := c.save(); err != nil {
+		return nil, fmt.Errorf("Unable to save cassette %s: %w", c.Path, err)
+	}
+	return resp, nil
+}
+
+// replay serves the first not yet played interaction
+// with the same method, URL and body as the request
+func (c *Cassette) replay(req *http.Request, body []byte) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	url := req.URL.String()
+	for i, interaction := range c.Interactions {
+		recorded := interaction.Request
+		if c.played[i] ||
+			recorded.Method != req.Method ||
+			recorded.URL != url ||
+			recorded.Body != string(body) {
+			continue
+		}
+
+		c.played[i] = true
+		return interaction.Response.httpResponse(req), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, url)
+}
+
+// Rewind makes all the interactions available for replay again
+func (c *Cassette) Rewind() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.played = make([]bool, len(c.Interactions))
+}
+
+// ------------------------------------------------------------------
+
+func (c *Cassette) redact(h http.Header) http.Header {
+	h = h.Clone()
+	for _, key := range c.RedactHeaders {
+		if h.Get(key) != "" {
+			h.Set(key, Redacted)
+		}
+	}
+	return h
+}
+
+func (r Response) httpResponse(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        r.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(r.Body))),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// readRequestBody reads the request body, if any,
+// replacing it so that it may be sent afterwards
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// ------------------------------------------------------------------
+
+// exists indicates if a file exists at the given path
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
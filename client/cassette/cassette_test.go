@@ -0,0 +1,72 @@
+package cassette_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/brinick/github/client/cachedclient"
+	"github.com/brinick/github/client/cassette"
+	"github.com/brinick/github/githubtest"
+)
+
+// TestRecordReplay tests that paginated results recorded
+// from a server are replayed once the server is gone
+func TestRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	srv := githubtest.NewServer()
+	srv.PerPage = 1
+	repo := srv.AddRepo("octo", "hello")
+	repo.AddIssue("one", "alice")
+	repo.AddIssue("two", "alice")
+
+	fetch := func(cas *cassette.Cassette) []string {
+		c := srv.Client(cachedclient.WithTransport(cas))
+		data := []string{}
+		url := srv.URL + "/repos/octo/hello/issues"
+		for url != "" {
+			page := c.Get(url, true)
+			if page.Err != nil {
+				t.Fatalf("Unexpected error: %v", page.Err)
+			}
+			data = append(data, page.Content.Data)
+			url = page.Content.NextLink
+		}
+		return data
+	}
+
+	recorder, err := cassette.New(path, cassette.ModeAuto)
+	if err != nil || recorder.Mode != cassette.ModeRecord {
+		t.Fatalf("Expected a recording cassette (err: %v)", err)
+	}
+	recorded := fetch(recorder)
+	srv.Close()
+
+	for _, interaction := range recorder.Interactions {
+		if auth := interaction.Request.Header.Get("Authorization"); auth != cassette.Redacted {
+			t.Errorf("Expected redacted token, got %q", auth)
+		}
+	}
+
+	player, err := cassette.New(path, cassette.ModeAuto)
+	if err != nil || player.Mode != cassette.ModeReplay {
+		t.Fatalf("Expected a replaying cassette (err: %v)", err)
+	}
+	replayed := fetch(player)
+
+	if len(recorded) != 2 || len(replayed) != len(recorded) {
+		t.Fatalf("Expected 2 pages, recorded %d and replayed %d", len(recorded), len(replayed))
+	}
+	for i := range recorded {
+		if replayed[i] != recorded[i] {
+			t.Errorf("Page %d: expected %s, got %s", i, recorded[i], replayed[i])
+		}
+	}
+
+	c := srv.Client(cachedclient.WithTransport(player), cachedclient.WithRetryPolicy(cachedclient.NoRetryPolicy))
+	page := c.Get(srv.URL+"/repos/octo/hello/pulls", true)
+	if !errors.Is(page.Err, cassette.ErrNoInteraction) {
+		t.Errorf("Expected ErrNoInteraction, got %v", page.Err)
+	}
+}
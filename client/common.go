@@ -2,17 +2,29 @@ package client
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 
+	"github.com/brinick/github"
 	"github.com/brinick/github/authorisation"
 )
 
 // ------------------------------------------------------------------
 
-// IGithubClient provides a Github client interface
+// IGithubClient provides a Github client interface.
+// Write operations accept any JSON-marshalable request body
+// (a struct, map[string]interface{}...), or nil for no body.
 type IGithubClient interface {
-	Post(string, bool, map[string]string) int
-	Patch(string, bool, map[string]string) int
+	Post(string, bool, interface{}) (*Response, error)
+	PostWithContext(context.Context, string, bool, interface{}) (*Response, error)
+	Patch(string, bool, interface{}) (*Response, error)
+	PatchWithContext(context.Context, string, bool, interface{}) (*Response, error)
+	Put(string, bool, interface{}) (*Response, error)
+	PutWithContext(context.Context, string, bool, interface{}) (*Response, error)
+	Delete(string, bool, interface{}) (*Response, error)
+	DeleteWithContext(context.Context, string, bool, interface{}) (*Response, error)
+	Endpoints() github.API
 	PageGetter
 }
 
@@ -88,6 +100,11 @@ type Page struct {
 	Content    *Payload
 	Err        error
 	StatusCode int
+	Attempts   int // number of times the request was sent
+
+	// Stale is true if the page was served from a cache without
+	// being validated by Github (e.g. as the client is offline)
+	Stale bool
 }
 
 func (p *Page) NoContent() bool {
@@ -110,6 +127,21 @@ func (p *Page) String() string {
 
 // ------------------------------------------------------------------
 
+// Response is the result of a write (POST, PATCH...) operation
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte // json
+	Attempts   int    // number of times the request was sent
+}
+
+// Decode parses the JSON response body into the value pointed to by v
+func (r *Response) Decode(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// ------------------------------------------------------------------
+
 // Payload represents the returned data from a Github GET
 // It is a "page" data.
 type Payload struct {
@@ -117,6 +149,12 @@ type Payload struct {
 	ETag         string
 	LastModified string
 	NextLink     string
+
+	// LastLink is the URL of the last page of results. Entries cached
+	// without it (by older versions) have their pages fetched
+	// sequentially, not prefetched, until they are next refreshed.
+	LastLink string
+	URL      string // the URL requested
 }
 
 func (p *Payload) Empty() bool {
@@ -131,7 +169,17 @@ func GetHeaders(
 	useStableAPI bool,
 	etag, lastModified string,
 ) (map[string]string, error) {
-	headers, err := authorisation.Headers(tr, useStableAPI)
+	return GetHeadersWithContext(context.TODO(), tr, useStableAPI, etag, lastModified)
+}
+
+// GetHeadersWithContext gets the headers required for a GET request
+func GetHeadersWithContext(
+	ctx context.Context,
+	tr authorisation.TokenRetriever,
+	useStableAPI bool,
+	etag, lastModified string,
+) (map[string]string, error) {
+	headers, err := authorisation.HeadersWithContext(ctx, tr, useStableAPI)
 	if err != nil {
 		return nil, err
 	}
@@ -152,3 +200,12 @@ func GetHeaders(
 func PostHeaders(tr authorisation.TokenRetriever, useStableAPI bool) (map[string]string, error) {
 	return authorisation.Headers(tr, useStableAPI)
 }
+
+// PostHeadersWithContext gets the headers required for a POST request
+func PostHeadersWithContext(
+	ctx context.Context,
+	tr authorisation.TokenRetriever,
+	useStableAPI bool,
+) (map[string]string, error) {
+	return authorisation.HeadersWithContext(ctx, tr, useStableAPI)
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Sentinel errors matched (via errors.Is) by the *APIError
+// returned for the corresponding Github responses
+var (
+	ErrNotFound     = errors.New("Not found")
+	ErrUnauthorized = errors.New("Unauthorized")
+	ErrForbidden    = errors.New("Forbidden")
+	ErrValidation   = errors.New("Validation failed")
+)
+
+// ErrOffline is returned by clients working offline, for GETs of
+// resources they have not cached and for write operations
+var ErrOffline = errors.New("Offline")
+
+// ------------------------------------------------------------------
+
+// FieldError is an entry of the "errors" array of a Github error
+// response, typically describing why a given field failed validation
+type FieldError struct {
+	Resource string `json:"resource,omitempty"`
+	Field    string `json:"field,omitempty"`
+	Code     string `json:"code,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// UnmarshalJSON accepts both the documented object form of a field error,
+// and the plain string form that Github sometimes returns instead
+func (fe *FieldError) UnmarshalJSON(data []byte) error {
+	var msg string
+	if err := json.Unmarshal(data, &msg); err == nil {
+		*fe = FieldError{Message: msg}
+		return nil
+	}
+
+	type fieldError FieldError
+	return json.Unmarshal(data, (*fieldError)(fe))
+}
+
+func (fe FieldError) String() string {
+	if fe.Field == "" {
+		return fe.Message
+	}
+	s := fmt.Sprintf("%s.%s: %s", fe.Resource, fe.Field, fe.Code)
+	if fe.Message != "" {
+		s += " (" + fe.Message + ")"
+	}
+	return s
+}
+
+// ------------------------------------------------------------------
+
+// APIError is returned when Github responds with an error status code.
+// It carries the parsed Github error body.
+type APIError struct {
+	StatusCode       int
+	Method           string
+	URL              string
+	Message          string       `json:"message"`
+	DocumentationURL string       `json:"documentation_url"`
+	Errors           []FieldError `json:"errors"`
+
+	// Err is the underlying cause, if known (e.g. a *RateLimitError)
+	Err error
+}
+
+// NewAPIError creates an APIError for the response with the given status
+// code and body, to the request with the given method and URL
+func NewAPIError(method, url string, statusCode int, body []byte) *APIError {
+	e := &APIError{}
+	if len(body) > 0 {
+		// not all error responses have a JSON body,
+		// and we still want an error if parsing fails
+		json.Unmarshal(body, e)
+	}
+
+	e.Method = method
+	e.URL = url
+	e.StatusCode = statusCode
+	return e
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+
+	s := fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.StatusCode, msg)
+	if len(e.Errors) > 0 {
+		details := make([]string, len(e.Errors))
+		for i, fe := range e.Errors {
+			details[i] = fe.String()
+		}
+		s += " [" + strings.Join(details, "; ") + "]"
+	}
+	return s
+}
+
+// Unwrap returns the underlying cause of the error, if any
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes the error match the sentinel error
+// corresponding to its status code
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden && e.Err == nil
+	case ErrValidation:
+		return e.StatusCode == http.StatusUnprocessableEntity
+	}
+	return false
+}
@@ -2,37 +2,63 @@ package noopclient
 
 import (
 	"context"
+
+	"github.com/brinick/github"
 	"github.com/brinick/github/client"
 )
 
 // ------------------------------------------------------------------
 
+var _ client.IGithubClient = (*NoOpClient)(nil)
+
+// NewClient creates a new NoOpClient
 func NewClient() *NoOpClient {
 	return &NoOpClient{}
 }
 
 // ------------------------------------------------------------------
 
+// NoOpClient is a Github client that does nothing: every GET returns
+// an empty page of results and every write succeeds with no content.
 type NoOpClient struct {
 }
 
+// Endpoints returns the public Github API URLs
+func (n *NoOpClient) Endpoints() github.API {
+	return github.APIURLs
+}
+
 func (n *NoOpClient) Get(url string, useStableAPI bool) *client.Page {
-	return nil
+	return n.GetWithContext(context.TODO(), url, useStableAPI)
 }
 func (n *NoOpClient) GetWithContext(ctx context.Context, url string, useStableAPI bool) *client.Page {
-	return nil
+	return &client.Page{URL: url, Content: &client.Payload{}}
+}
+
+func (n *NoOpClient) Post(url string, useStableAPI bool, data interface{}) (*client.Response, error) {
+	return n.PostWithContext(context.TODO(), url, useStableAPI, data)
+}
+func (n *NoOpClient) PostWithContext(ctx context.Context, url string, useStableAPI bool, data interface{}) (*client.Response, error) {
+	return &client.Response{}, nil
+}
+
+func (n *NoOpClient) Patch(url string, useStableAPI bool, data interface{}) (*client.Response, error) {
+	return n.PatchWithContext(context.TODO(), url, useStableAPI, data)
+}
+func (n *NoOpClient) PatchWithContext(ctx context.Context, url string, useStableAPI bool, data interface{}) (*client.Response, error) {
+	return &client.Response{}, nil
 }
 
-func (n *NoOpClient) Post(url string, useStableAPI bool, data map[string]string) (int, error) {
-	return 0, nil
+func (n *NoOpClient) Put(url string, useStableAPI bool, data interface{}) (*client.Response, error) {
+	return n.PutWithContext(context.TODO(), url, useStableAPI, data)
 }
-func (n *NoOpClient) PostWithContext(ctx context.Context, url string, useStableAPI bool, data map[string]string) *client.Page {
-	return nil
+func (n *NoOpClient) PutWithContext(ctx context.Context, url string, useStableAPI bool, data interface{}) (*client.Response, error) {
+	return &client.Response{}, nil
 }
 
-func (n *NoOpClient) Patch(url string, useStableAPI bool) *client.Page {
-	return nil
+func (n *NoOpClient) Delete(url string, useStableAPI bool, data interface{}) (*client.Response, error) {
+	return n.DeleteWithContext(context.TODO(), url, useStableAPI, data)
 }
-func (n *NoOpClient) PatchWithContext(ctx context.Context, url string, useStableAPI bool) *client.Page {
-	return nil
+func (n *NoOpClient) DeleteWithContext(ctx context.Context, url string, useStableAPI bool, data interface{}) (*client.Response, error) {
+	return &client.Response{}, nil
 }
@@ -0,0 +1,193 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// PrefetchPageIterator is an iterator over Github results pages which,
+// once the first page gives the number of the last one, fetches the
+// following pages concurrently, while still returning them in order.
+// This requires page number based pagination (a "page" query parameter);
+// other results are iterated over one page after the other.
+//
+// At most Workers requests are made at once, and pages are fetched at
+// most twice as many pages ahead of the one returned. Iterators stopped
+// before the last page should be closed, to stop fetching.
+type PrefetchPageIterator struct {
+	StartURL string
+	Workers  int
+
+	g       PageGetter
+	err     error
+	started bool
+	done    bool
+
+	// when fetching sequentially
+	seq *GithubPageIterator
+
+	// when prefetching
+	results []chan *Page
+	next    int
+	ahead   chan struct{}
+	cancel  context.CancelFunc
+	once    sync.Once
+}
+
+// NewPrefetchPageIterator creates a new PageIterator fetching
+// the pages of results with the given number of workers
+func NewPrefetchPageIterator(startURL string, pageGetter PageGetter, workers int) *PrefetchPageIterator {
+	if workers < 1 {
+		workers = 1
+	}
+	return &PrefetchPageIterator{StartURL: startURL, Workers: workers, g: pageGetter}
+}
+
+func (i *PrefetchPageIterator) Next() *Page {
+	return i.NextWithContext(context.TODO())
+}
+
+// NextWithContext returns the next page of results, or nil if there
+// are no more. The context of the first call is also that of the
+// prefetching requests.
+func (i *PrefetchPageIterator) NextWithContext(ctx context.Context) *Page {
+	if i.done {
+		return nil
+	}
+
+	if !i.started {
+		i.started = true
+		page := i.g.GetWithContext(ctx, i.StartURL, true)
+		i.err = page.Err
+		if page.Err != nil || page.Content == nil || page.IsLast() {
+			i.done = true
+			return page
+		}
+
+		urls := pageURLs(page.Content.NextLink, page.Content.LastLink)
+		if urls == nil {
+			i.seq = &GithubPageIterator{StartURL: i.StartURL, Current: page, g: i.g}
+		} else {
+			i.prefetch(ctx, urls)
+		}
+		return page
+	}
+
+	if i.seq != nil {
+		page := i.seq.NextWithContext(ctx)
+		i.err = i.seq.Error()
+		if page == nil || page.Err != nil || page.IsLast() {
+			i.done = true
+		}
+		return page
+	}
+
+	if i.next == len(i.results) {
+		i.Close()
+		return nil
+	}
+
+	var page *Page
+	select {
+	case page = <-i.results[i.next]:
+		i.next++
+		<-i.ahead
+	case <-ctx.Done():
+		page = &Page{Err: ctx.Err()}
+	}
+
+	i.err = page.Err
+	if page.Err != nil {
+		i.Close()
+	}
+	return page
+}
+
+// Error returns the error of the last page returned
+func (i *PrefetchPageIterator) Error() error {
+	return i.err
+}
+
+// Close stops fetching pages
+func (i *PrefetchPageIterator) Close() {
+	i.done = true
+	i.once.Do(func() {
+		if i.cancel != nil {
+			i.cancel()
+		}
+	})
+}
+
+// prefetch starts fetching the pages with the given URLs
+func (i *PrefetchPageIterator) prefetch(ctx context.Context, urls []string) {
+	ctx, i.cancel = context.WithCancel(ctx)
+	i.results = make([]chan *Page, len(urls))
+	for n := range i.results {
+		i.results[n] = make(chan *Page, 1)
+	}
+	i.ahead = make(chan struct{}, 2*i.Workers)
+
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for n := range urls {
+			select {
+			case i.ahead <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- n:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for w := 0; w < i.Workers; w++ {
+		go func() {
+			for n := range jobs {
+				i.results[n] <- i.g.GetWithContext(ctx, urls[n], true)
+			}
+		}()
+	}
+}
+
+// pageURLs returns the URLs of the pages from the next to the last one
+// (included), or nil if they do not differ by a "page" query parameter
+func pageURLs(nextLink, lastLink string) []string {
+	next, err := url.Parse(nextLink)
+	if err != nil {
+		return nil
+	}
+	last, err := url.Parse(lastLink)
+	if err != nil {
+		return nil
+	}
+
+	nextQuery, lastQuery := next.Query(), last.Query()
+	first, err1 := strconv.Atoi(nextQuery.Get("page"))
+	final, err2 := strconv.Atoi(lastQuery.Get("page"))
+	if err1 != nil || err2 != nil || final < first {
+		return nil
+	}
+
+	nextQuery.Del("page")
+	lastQuery.Del("page")
+	if next.Scheme != last.Scheme || next.Host != last.Host || next.Path != last.Path ||
+		nextQuery.Encode() != lastQuery.Encode() {
+		return nil
+	}
+
+	var urls []string
+	for n := first; n <= final; n++ {
+		query := next.Query()
+		query.Set("page", strconv.Itoa(n))
+		u := *next
+		u.RawQuery = query.Encode()
+		urls = append(urls, u.String())
+	}
+	return urls
+}
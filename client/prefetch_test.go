@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// numberedPages serves n pages of results numbered via a "page" parameter
+type numberedPages struct {
+	n int
+
+	mu               sync.Mutex
+	active, maxCalls int
+}
+
+func (p *numberedPages) Get(u string, useStableAPI bool) *Page {
+	return p.GetWithContext(context.TODO(), u, useStableAPI)
+}
+
+func (p *numberedPages) GetWithContext(ctx context.Context, u string, useStableAPI bool) *Page {
+	p.mu.Lock()
+	p.active++
+	if p.active > p.maxCalls {
+		p.maxCalls = p.active
+	}
+	p.mu.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	p.mu.Lock()
+	p.active--
+	p.mu.Unlock()
+
+	parsed, _ := url.Parse(u)
+	page, _ := strconv.Atoi(parsed.Query().Get("page"))
+	if page == 0 {
+		page = 1
+	}
+
+	content := &Payload{Data: strconv.Itoa(page), URL: u}
+	if page < p.n {
+		content.NextLink = fmt.Sprintf("https://api.github.test/items?page=%d&per_page=2", page+1)
+		content.LastLink = fmt.Sprintf("https://api.github.test/items?page=%d&per_page=2", p.n)
+	}
+	return &Page{URL: u, Content: content, StatusCode: 200}
+}
+
+// TestPrefetch tests that pages are fetched concurrently, but returned in order
+func TestPrefetch(t *testing.T) {
+	getter := &numberedPages{n: 20}
+	it := NewPrefetchPageIterator("https://api.github.test/items?per_page=2", getter, 3)
+
+	var got []string
+	for page := it.Next(); page != nil; page = it.Next() {
+		if page.Err != nil {
+			t.Fatalf("Unexpected error: %v", page.Err)
+		}
+		got = append(got, page.Content.Data)
+	}
+
+	if len(got) != 20 {
+		t.Fatalf("Expected 20 pages, got %d", len(got))
+	}
+	for i, data := range got {
+		if data != strconv.Itoa(i+1) {
+			t.Fatalf("Pages out of order: %v", got)
+		}
+	}
+	if getter.maxCalls < 2 || getter.maxCalls > 3 {
+		t.Errorf("Expected 2 or 3 concurrent requests, got %d", getter.maxCalls)
+	}
+}
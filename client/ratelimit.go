@@ -0,0 +1,153 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrRateLimited is matched (via errors.Is) by errors
+// caused by a primary or secondary Github rate limit
+var ErrRateLimited = errors.New("Rate limit exceeded")
+
+// secondaryLimitWait is how long Github asks clients to wait after hitting
+// a secondary rate limit when the response carries no Retry-After header
+const secondaryLimitWait = time.Minute
+
+// minLimitWait is the least time waited for a primary rate limit, e.g.
+// if its reset time has already passed as the clocks are out of sync
+const minLimitWait = time.Second
+
+// ------------------------------------------------------------------
+
+// RateLimit is the rate limit state reported by Github in response headers
+type RateLimit struct {
+	Limit      int
+	Remaining  int
+	Used       int
+	Reset      time.Time
+	RetryAfter time.Duration
+}
+
+// ParseRateLimit extracts the rate limit state from the response headers.
+// Missing integer values are set to -1.
+func ParseRateLimit(h http.Header) RateLimit {
+	rl := RateLimit{
+		Limit:     headerInt(h, "X-RateLimit-Limit"),
+		Remaining: headerInt(h, "X-RateLimit-Remaining"),
+		Used:      headerInt(h, "X-RateLimit-Used"),
+	}
+
+	if reset := headerInt(h, "X-RateLimit-Reset"); reset >= 0 {
+		rl.Reset = time.Unix(int64(reset), 0)
+	}
+	if after := headerInt(h, "Retry-After"); after >= 0 {
+		rl.RetryAfter = time.Duration(after) * time.Second
+	}
+	return rl
+}
+
+// Known indicates if the response carried rate limit headers at all
+func (rl RateLimit) Known() bool {
+	return rl.Limit >= 0 && rl.Remaining >= 0
+}
+
+func (rl RateLimit) String() string {
+	return fmt.Sprintf("%d/%d (reset %s)", rl.Remaining, rl.Limit, rl.Reset.Format(time.RFC3339))
+}
+
+func headerInt(h http.Header, key string) int {
+	val := h.Get(key)
+	if val == "" {
+		return -1
+	}
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		return -1
+	}
+	return i
+}
+
+// ------------------------------------------------------------------
+
+// RateLimitError is returned when Github refused a request because of
+// a rate limit. Secondary limits are those imposed on bursts of requests,
+// independently of the hourly quota of the token.
+type RateLimitError struct {
+	Rate      RateLimit
+	Secondary bool
+	Message   string
+}
+
+func (e *RateLimitError) Error() string {
+	kind := "Primary"
+	if e.Secondary {
+		kind = "Secondary"
+	}
+	msg := fmt.Sprintf("%s rate limit exceeded, retry in %s", kind, e.Wait(time.Now()).Round(time.Second))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Is makes the error match ErrRateLimited
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// Wait returns how long to wait, from the given time,
+// before the rate limit is lifted
+func (e *RateLimitError) Wait(now time.Time) time.Duration {
+	if e.Rate.RetryAfter > 0 {
+		return e.Rate.RetryAfter
+	}
+
+	if !e.Secondary && !e.Rate.Reset.IsZero() {
+		if wait := e.Rate.Reset.Sub(now); wait > 0 {
+			// the reset time has a 1 second granularity
+			return wait + time.Second
+		}
+		return minLimitWait
+	}
+
+	return secondaryLimitWait
+}
+
+// CheckRateLimit returns a RateLimitError if the response with the given
+// status code, headers and body indicates that a rate limit was hit,
+// or nil if it was not (e.g. a 403 for lack of permissions).
+func CheckRateLimit(statusCode int, h http.Header, body []byte) *RateLimitError {
+	if statusCode != http.StatusForbidden && statusCode != http.StatusTooManyRequests {
+		return nil
+	}
+
+	rl := ParseRateLimit(h)
+	msg := bodyMessage(body)
+
+	switch {
+	case rl.Remaining == 0:
+		return &RateLimitError{Rate: rl, Message: msg}
+	case rl.RetryAfter > 0,
+		statusCode == http.StatusTooManyRequests,
+		bytes.Contains(bytes.ToLower(body), []byte("secondary rate limit")),
+		bytes.Contains(bytes.ToLower(body), []byte("abuse detection")):
+		return &RateLimitError{Rate: rl, Secondary: true, Message: msg}
+	}
+	return nil
+}
+
+// bodyMessage extracts the "message" of a Github JSON error body
+func bodyMessage(body []byte) string {
+	var content struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &content) != nil {
+		return ""
+	}
+	return content.Message
+}
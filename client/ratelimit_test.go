@@ -0,0 +1,88 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestCheckRateLimit tests that rate limits are told apart from permission errors
+func TestCheckRateLimit(t *testing.T) {
+	reset := time.Now().Add(10 * time.Minute).Unix()
+	pastReset := time.Now().Add(-time.Minute).Unix()
+
+	tt := []struct {
+		name       string
+		statusCode int
+		headers    map[string]string
+		body       string
+		limited    bool
+		secondary  bool
+	}{
+		{"OK", 200, map[string]string{"X-RateLimit-Remaining": "0"}, "", false, false},
+		{
+			"Primary",
+			403,
+			map[string]string{
+				"X-RateLimit-Limit":     "5000",
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     strconv.FormatInt(reset, 10),
+			},
+			`{"message": "API rate limit exceeded"}`,
+			true,
+			false,
+		},
+		{
+			"Past reset",
+			403,
+			map[string]string{
+				"X-RateLimit-Limit":     "5000",
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     strconv.FormatInt(pastReset, 10),
+			},
+			`{"message": "API rate limit exceeded"}`,
+			true,
+			false,
+		},
+		{"Retry-After", 403, map[string]string{"Retry-After": "30"}, "", true, true},
+		{"Secondary body", 403, nil, `{"message": "You have exceeded a secondary rate limit"}`, true, true},
+		{"Too many requests", 429, nil, "", true, true},
+		{
+			"Forbidden",
+			403,
+			map[string]string{"X-RateLimit-Limit": "5000", "X-RateLimit-Remaining": "4999"},
+			`{"message": "Resource not accessible by integration"}`,
+			false,
+			false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			h := http.Header{}
+			for key, val := range tc.headers {
+				h.Set(key, val)
+			}
+
+			rle := CheckRateLimit(tc.statusCode, h, []byte(tc.body))
+			if (rle != nil) != tc.limited {
+				t.Fatalf("Expected limited=%t, got %v", tc.limited, rle)
+			}
+			if rle == nil {
+				return
+			}
+
+			if rle.Secondary != tc.secondary {
+				t.Errorf("Expected secondary=%t, got %t", tc.secondary, rle.Secondary)
+			}
+			if !errors.Is(rle, ErrRateLimited) {
+				t.Errorf("Expected error to match ErrRateLimited")
+			}
+			if wait := rle.Wait(time.Now()); wait < minLimitWait || wait > 11*time.Minute {
+				t.Errorf("Unexpected wait %v", wait)
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+// Command github-cache inspects and manages the cache of the Github
+// client responses, stored in a gob file (by default the one given by
+// the GITHUB_CACHE_FILE env var, or .github-cache) or a cache directory.
+//
+// Usage:
+//
+//	github-cache [-file path | -dir path] <command> [arguments]
+//
+// The commands are:
+//
+//	list                       list the entries: key, URL, ETag, Last-Modified, size
+//	show <key or URL>          print the payload of the entries
+//	purge [-prefix url] [-older-than duration]
+//	                           remove the entries below a URL and/or not accessed recently
+//	compact [-max-entries n] [-max-bytes n]
+//	                           rewrite the cache, evicting entries beyond the bounds
+//	export [-o file]           write the entries as JSON
+//	import [-hints] [file]     add the entries of a JSON export
+//
+// Exported entries are keyed on the token that fetched them. Importing them
+// with -hints keys them on their URL only instead: clients with any token
+// then use them to make conditional requests, which is how a CI runner cache
+// is best seeded.
+//
+// Entries exported by older versions have no last page link: the
+// pages of their results are fetched sequentially, rather than
+// prefetched, until they are next refreshed.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/brinick/github/client"
+	"github.com/brinick/github/client/cachedclient"
+)
+
+// Entry is the JSON representation of a cache entry
+type Entry struct {
+	Key          string    `json:"key"`
+	URL          string    `json:"url,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	NextLink     string    `json:"next_link,omitempty"`
+	LastLink     string    `json:"last_link,omitempty"`
+	LastAccess   time.Time `json:"last_access,omitempty"`
+	Data         string    `json:"data"`
+}
+
+// lastAccesser is implemented by caches tracking entry access times
+type lastAccesser interface {
+	LastAccess(key string) (time.Time, bool)
+}
+
+// errUsage is returned by run for invalid command lines, once
+// the usage or the error is printed
+var errUsage = errors.New("invalid usage")
+
+func usage(flags *flag.FlagSet) {
+	fmt.Fprintln(flags.Output(), "usage: github-cache [-file path | -dir path] list|show|purge|compact|export|import [arguments]")
+	flags.PrintDefaults()
+}
+
+func main() {
+	err := run(os.Args[1:], os.Stdout)
+	switch {
+	case errors.Is(err, errUsage):
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "github-cache:", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the command line with the given arguments,
+// writing the command output to stdout
+func run(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("github-cache", flag.ContinueOnError)
+	file := flags.String("file", "", "cache file (default: $GITHUB_CACHE_FILE or .github-cache)")
+	dir := flags.String("dir", "", "cache directory, instead of a cache file")
+	flags.Usage = func() { usage(flags) }
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	switch flags.Arg(0) {
+	case "list", "show", "purge", "compact", "export", "import":
+	default:
+		flags.Usage()
+		return errUsage
+	}
+
+	cache, err := openCache(*file, *dir)
+	if err != nil {
+		return err
+	}
+
+	err = command(cache, flags.Args(), stdout)
+	if closeErr := cache.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// command runs the command, the first of the given arguments, on the cache
+func command(cache cachedclient.Cache, args []string, stdout io.Writer) error {
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "list":
+		return list(cache, stdout)
+	case "show":
+		return show(cache, args, stdout)
+	case "purge":
+		return purge(cache, args, stdout)
+	case "compact":
+		return compact(cache, args)
+	case "export":
+		return export(cache, args, stdout)
+	case "import":
+		return importEntries(cache, args, stdout)
+	}
+	return fmt.Errorf("unknown command %s", cmd)
+}
+
+func openCache(file, dir string) (cachedclient.Cache, error) {
+	if dir != "" {
+		return cachedclient.NewDiskCache(dir)
+	}
+	if file != "" {
+		return cachedclient.NewCacheAt(file)
+	}
+	return cachedclient.NewCache()
+}
+
+// entries returns the cache entries, sorted by URL
+func entries(cache cachedclient.Cache) []Entry {
+	all := []Entry{}
+	cache.Range(func(key string, value client.Payload) bool {
+		entry := Entry{
+			Key:          key,
+			URL:          value.URL,
+			ETag:         value.ETag,
+			LastModified: value.LastModified,
+			NextLink:     value.NextLink,
+			LastLink:     value.LastLink,
+			Data:         value.Data,
+		}
+		if la, ok := cache.(lastAccesser); ok {
+			entry.LastAccess, _ = la.LastAccess(key)
+		}
+		all = append(all, entry)
+		return true
+	})
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].URL != all[j].URL {
+			return all[i].URL < all[j].URL
+		}
+		return all[i].Key < all[j].Key
+	})
+	return all
+}
+
+// ------------------------------------------------------------------
+
+func list(cache cachedclient.Cache, stdout io.Writer) error {
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tURL\tETAG\tLAST-MODIFIED\tSIZE")
+	for _, e := range entries(cache) {
+		fmt.Fprintf(
+			w, "%s\t%s\t%s\t%s\t%d\n",
+			e.Key, orDash(e.URL), orDash(e.ETag), orDash(e.LastModified), len(e.Data),
+		)
+	}
+	return w.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func show(cache cachedclient.Cache, args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("show takes a key or URL")
+	}
+
+	found := false
+	for _, e := range entries(cache) {
+		if e.Key != args[0] && e.URL != args[0] {
+			continue
+		}
+		found = true
+		fmt.Fprintf(stdout, "# %s %s\n", e.Key, e.URL)
+		fmt.Fprintln(stdout, e.Data)
+	}
+	if !found {
+		return fmt.Errorf("no entry for %s", args[0])
+	}
+	return nil
+}
+
+func purge(cache cachedclient.Cache, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("purge", flag.ContinueOnError)
+	prefix := flags.String("prefix", "", "remove the entries of this URL and the URLs below it")
+	olderThan := flags.Duration("older-than", 0, "remove the entries not accessed for this long")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if *prefix == "" && *olderThan == 0 {
+		return fmt.Errorf("purge needs -prefix and/or -older-than")
+	}
+
+	la, tracksAccess := cache.(lastAccesser)
+	if *olderThan > 0 && !tracksAccess {
+		return fmt.Errorf("this cache does not track access times")
+	}
+
+	n := 0
+	for _, e := range entries(cache) {
+		if *prefix != "" && !cachedclient.HasURLPrefix(e.URL, *prefix) {
+			continue
+		}
+		if *olderThan > 0 {
+			if t, _ := la.LastAccess(e.Key); time.Since(t) < *olderThan {
+				continue
+			}
+		}
+		if err := cache.Delete(e.Key); err != nil {
+			return err
+		}
+		n++
+	}
+	fmt.Fprintf(stdout, "Purged %d entries\n", n)
+	return nil
+}
+
+func compact(cache cachedclient.Cache, args []string) error {
+	flags := flag.NewFlagSet("compact", flag.ContinueOnError)
+	maxEntries := flags.Int("max-entries", 0, "maximum number of entries to keep")
+	maxBytes := flags.Int64("max-bytes", 0, "maximum size of the entries to keep")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	switch c := cache.(type) {
+	case *cachedclient.PickledCache:
+		if *maxEntries > 0 {
+			c.MaxEntries = *maxEntries
+		}
+		if *maxBytes > 0 {
+			c.MaxBytes = *maxBytes
+		}
+		return c.Save()
+	case *cachedclient.DiskCache:
+		if *maxEntries > 0 {
+			c.MaxEntries = *maxEntries
+		}
+		if *maxBytes > 0 {
+			c.MaxBytes = *maxBytes
+		}
+		return c.Compact()
+	}
+	return fmt.Errorf("this cache cannot be compacted")
+}
+
+func export(cache cachedclient.Cache, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := flags.String("o", "", "output file (default: standard output)")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	w := stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries(cache))
+}
+
+func importEntries(cache cachedclient.Cache, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	hints := flags.Bool("hints", false, "key the entries on their URL only, for use by any token")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	var r io.Reader = os.Stdin
+	if flags.NArg() > 0 {
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var imported []Entry
+	if err := json.NewDecoder(r).Decode(&imported); err != nil {
+		return fmt.Errorf("invalid export: %v", err)
+	}
+
+	n := 0
+	for _, e := range imported {
+		key := e.Key
+		if *hints {
+			if e.URL == "" {
+				continue
+			}
+			key = cachedclient.URLKey(e.URL)
+		}
+		payload := client.Payload{
+			Data:         e.Data,
+			ETag:         e.ETag,
+			LastModified: e.LastModified,
+			NextLink:     e.NextLink,
+			LastLink:     e.LastLink,
+			URL:          e.URL,
+		}
+		if err := cache.Set(key, payload); err != nil {
+			return err
+		}
+		n++
+	}
+	fmt.Fprintf(stdout, "Imported %d entries\n", n)
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brinick/github/client"
+	"github.com/brinick/github/client/cachedclient"
+)
+
+const base = "https://api.github.test/repos/octo"
+
+// newDiskCache returns a cache directory holding entries
+// with the given keys, for the URLs below base
+func newDiskCache(t *testing.T, urls map[string]string) string {
+	dir := t.TempDir()
+	cache, err := cachedclient.NewDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, url := range urls {
+		cache.Set(key, client.Payload{Data: "[]", ETag: `"1"`, URL: url, LastLink: url + "?page=3"})
+	}
+	return dir
+}
+
+func keys(dir string) []string {
+	cache, _ := cachedclient.NewDiskCache(dir)
+	var found []string
+	for _, e := range entries(cache) {
+		found = append(found, e.Key)
+	}
+	return found
+}
+
+// ------------------------------------------------------------------
+
+// TestPurge tests purging the entries below a URL,
+// and those not accessed for some time
+func TestPurge(t *testing.T) {
+	dir := newDiskCache(t, map[string]string{
+		"aaa1": base + "/hello",
+		"bbb2": base + "/hello/issues?page=2",
+		"ccc3": base + "/hello-world",
+		"ddd4": base + "/other",
+	})
+
+	var out bytes.Buffer
+	if err := run([]string{"-dir", dir, "purge", "-prefix", base + "/hello"}, &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := strings.Join(keys(dir), ","); got != "ccc3,ddd4" || out.String() != "Purged 2 entries\n" {
+		t.Errorf("Expected the entries below the prefix to be purged, got %s (%q)", got, out.String())
+	}
+
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(dir, "cc", "ccc3"), old, old)
+	if err := run([]string{"-dir", dir, "purge", "-older-than", "30m"}, &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := strings.Join(keys(dir), ","); got != "ddd4" {
+		t.Errorf("Expected the entry not accessed recently to be purged, got %s", got)
+	}
+
+	err := command(cachedclient.NewMemoryCache(), []string{"purge", "-older-than", "30m"}, &out)
+	if err == nil {
+		t.Errorf("Expected an error for a cache not tracking access times")
+	}
+}
+
+// TestExportImport tests exporting entries, and importing
+// them under the same keys or as hints keyed on their URL
+func TestExportImport(t *testing.T) {
+	urls := map[string]string{
+		"aaa1": base + "/hello",
+		"bbb2": "",
+	}
+	src := newDiskCache(t, urls)
+	export := filepath.Join(t.TempDir(), "export.json")
+	var out bytes.Buffer
+	if err := run([]string{"-dir", src, "export", "-o", export}, &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, hints := range []bool{false, true} {
+		dst := t.TempDir()
+		args := []string{"-dir", dst, "import", export}
+		want := "bbb2,aaa1" // by URL
+		if hints {
+			args = []string{"-dir", dst, "import", "-hints", export}
+			want = cachedclient.URLKey(urls["aaa1"])
+		}
+		if err := run(args, &out); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		cache, _ := cachedclient.NewDiskCache(dst)
+		imported := entries(cache)
+		if got := strings.Join(keys(dst), ","); got != want {
+			t.Errorf("Expected keys %s (hints: %v), got %s", want, hints, got)
+			continue
+		}
+		if e := imported[len(imported)-1]; e.ETag != `"1"` || e.LastLink != urls["aaa1"]+"?page=3" {
+			t.Errorf("Expected the entry to round trip (hints: %v), got %+v", hints, e)
+		}
+	}
+}
+
+// TestCompact tests that caches which cannot be compacted are reported
+func TestCompact(t *testing.T) {
+	if err := command(cachedclient.NewMemoryCache(), []string{"compact"}, &bytes.Buffer{}); err == nil {
+		t.Errorf("Expected an error compacting a memory cache")
+	}
+}
@@ -1,8 +1,14 @@
 package github
 
+import (
+	"strings"
+)
+
 // API groups useful info
 type API struct {
 	URL     string
+	UPLOADS string
+	GRAPHQL string
 	STABLE  string
 	PREVIEW string
 }
@@ -10,6 +16,30 @@ type API struct {
 // APIURLs provides Github URL info
 var APIURLs = API{
 	URL:     "https://api.github.com",
+	UPLOADS: "https://uploads.github.com",
+	GRAPHQL: "https://api.github.com/graphql",
 	STABLE:  "application/vnd.github.v3+json",
 	PREVIEW: "application/vnd.github.korra-preview",
 }
+
+// NewAPI returns the API info for the REST API at the given base URL.
+// For a Github Enterprise Server base URL of the form
+// https://host/api/v3, the uploads and GraphQL URLs are
+// https://host/api/uploads and https://host/api/graphql respectively.
+func NewAPI(baseURL string) API {
+	baseURL = strings.TrimRight(baseURL, "/")
+	if baseURL == APIURLs.URL {
+		return APIURLs
+	}
+
+	api := APIURLs
+	api.URL = baseURL
+	if root := strings.TrimSuffix(baseURL, "/api/v3"); root != baseURL {
+		api.UPLOADS = root + "/api/uploads"
+		api.GRAPHQL = root + "/api/graphql"
+	} else {
+		api.UPLOADS = baseURL
+		api.GRAPHQL = baseURL + "/graphql"
+	}
+	return api
+}
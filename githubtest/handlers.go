@@ -0,0 +1,709 @@
+package githubtest
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/brinick/github/client"
+)
+
+// routes returns the handler of all the emulated API endpoints.
+// Handlers are called with the server lock held.
+func (s *Server) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rate_limit", s.getRateLimit)
+	mux.HandleFunc("PUT /user/starred/{owner}/{repo}", s.starRepo)
+	mux.HandleFunc("DELETE /user/starred/{owner}/{repo}", s.starRepo)
+
+	mux.HandleFunc("GET /repos/{owner}/{repo}/branches", s.listBranches)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/branches/{branch...}", s.getBranch)
+	mux.HandleFunc("DELETE /repos/{owner}/{repo}/git/refs/heads/{branch...}", s.deleteBranch)
+
+	mux.HandleFunc("GET /repos/{owner}/{repo}/commits", s.listCommits)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/commits/{ref}", s.getCommit)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/commits/{ref}/statuses", s.listStatuses)
+	mux.HandleFunc("POST /repos/{owner}/{repo}/statuses/{sha}", s.createStatus)
+
+	mux.HandleFunc("GET /repos/{owner}/{repo}/pulls", s.listPulls)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/pulls/{number}", s.getPull)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/pulls/{number}/commits", s.listPullCommits)
+	mux.HandleFunc("PUT /repos/{owner}/{repo}/pulls/{number}/merge", s.mergePull)
+
+	mux.HandleFunc("GET /repos/{owner}/{repo}/issues", s.listIssues)
+	mux.HandleFunc("POST /repos/{owner}/{repo}/issues", s.createIssue)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/issues/{number}", s.getIssue)
+	mux.HandleFunc("PATCH /repos/{owner}/{repo}/issues/{number}", s.editIssue)
+	mux.HandleFunc("PUT /repos/{owner}/{repo}/issues/{number}/lock", s.lockIssue)
+	mux.HandleFunc("DELETE /repos/{owner}/{repo}/issues/{number}/{what}", s.deleteIssueResource)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/issues/{number}/comments", s.listComments)
+	mux.HandleFunc("POST /repos/{owner}/{repo}/issues/{number}/comments", s.createComment)
+	mux.HandleFunc("PATCH /repos/{owner}/{repo}/issues/comments/{id}", s.editComment)
+
+	mux.HandleFunc("GET /repos/{owner}/{repo}/collaborators/{login}", s.collaborator)
+	mux.HandleFunc("PUT /repos/{owner}/{repo}/collaborators/{login}", s.collaborator)
+	mux.HandleFunc("DELETE /repos/{owner}/{repo}/collaborators/{login}", s.collaborator)
+
+	mux.HandleFunc("GET /orgs/{org}", s.getOrg)
+	mux.HandleFunc("GET /orgs/{org}/teams", s.listTeams)
+	mux.HandleFunc("GET /orgs/{org}/teams/{slug}", s.getTeam)
+	mux.HandleFunc("GET /orgs/{org}/teams/{slug}/members", s.listMembers)
+	mux.HandleFunc("GET /orgs/{org}/teams/{slug}/memberships/{login}", s.membership)
+	mux.HandleFunc("PUT /orgs/{org}/teams/{slug}/memberships/{login}", s.membership)
+	mux.HandleFunc("DELETE /orgs/{org}/teams/{slug}/memberships/{login}", s.membership)
+
+	// the URLs of teams, as rendered
+	mux.HandleFunc("GET /organizations/{org_id}/team/{team_id}", s.getTeam)
+	mux.HandleFunc("GET /organizations/{org_id}/team/{team_id}/members", s.listMembers)
+	mux.HandleFunc("GET /organizations/{org_id}/team/{team_id}/memberships/{login}", s.membership)
+	mux.HandleFunc("PUT /organizations/{org_id}/team/{team_id}/memberships/{login}", s.membership)
+	mux.HandleFunc("DELETE /organizations/{org_id}/team/{team_id}/memberships/{login}", s.membership)
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "Not Found")
+	})
+
+	return mux
+}
+
+// ------------------------------------------------------------------
+// Lookup helpers, writing a 404 response if the entity is not found
+// ------------------------------------------------------------------
+
+func (s *Server) repo(w http.ResponseWriter, r *http.Request) *Repo {
+	repo := s.repos[r.PathValue("owner")+"/"+r.PathValue("repo")]
+	if repo == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+	return repo
+}
+
+func (s *Server) issue(w http.ResponseWriter, r *http.Request, pullsOnly bool) (*Repo, *Issue) {
+	repo := s.repo(w, r)
+	if repo == nil {
+		return nil, nil
+	}
+
+	number, _ := strconv.Atoi(r.PathValue("number"))
+	issue := repo.issue(number)
+	if issue == nil || (pullsOnly && issue.Pull == nil) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return nil, nil
+	}
+	return repo, issue
+}
+
+func (s *Server) org(w http.ResponseWriter, r *http.Request) *Org {
+	org := s.orgs[r.PathValue("org")]
+	if id := r.PathValue("org_id"); id != "" {
+		for _, o := range s.orgs {
+			if strconv.Itoa(o.ID) == id {
+				org = o
+			}
+		}
+	}
+	if org == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+	return org
+}
+
+func (s *Server) team(w http.ResponseWriter, r *http.Request) (*Org, *Team) {
+	org := s.org(w, r)
+	if org == nil {
+		return nil, nil
+	}
+
+	var team *Team
+	if id := r.PathValue("team_id"); id != "" {
+		for _, t := range org.Teams {
+			if strconv.Itoa(t.ID) == id {
+				team = t
+			}
+		}
+	} else {
+		team = org.team(r.PathValue("slug"))
+	}
+	if team == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return nil, nil
+	}
+	return org, team
+}
+
+// ------------------------------------------------------------------
+
+func (s *Server) getRateLimit(w http.ResponseWriter, r *http.Request) {
+	core := jsonObject{"limit": 5000, "remaining": 4999, "reset": time.Now().Add(time.Hour).Unix()}
+	writeJSON(w, r, http.StatusOK, jsonObject{"resources": jsonObject{"core": core}, "rate": core})
+}
+
+func (s *Server) starRepo(w http.ResponseWriter, r *http.Request) {
+	if repo := s.repo(w, r); repo != nil {
+		repo.Starred = r.Method == "PUT"
+		writeNoContent(w)
+	}
+}
+
+// ------------------------------------------------------------------
+
+func (s *Server) listBranches(w http.ResponseWriter, r *http.Request) {
+	repo := s.repo(w, r)
+	if repo == nil {
+		return
+	}
+
+	items := []interface{}{}
+	for _, branch := range repo.Branches {
+		items = append(items, repo.renderBranch(branch))
+	}
+	s.paginate(w, r, items)
+}
+
+func (s *Server) getBranch(w http.ResponseWriter, r *http.Request) {
+	repo := s.repo(w, r)
+	if repo == nil {
+		return
+	}
+
+	branch, _ := repo.branch(r.PathValue("branch"))
+	if branch == nil {
+		writeError(w, http.StatusNotFound, "Branch not found")
+		return
+	}
+	writeJSON(w, r, http.StatusOK, repo.renderBranch(branch))
+}
+
+func (s *Server) deleteBranch(w http.ResponseWriter, r *http.Request) {
+	repo := s.repo(w, r)
+	if repo == nil {
+		return
+	}
+
+	_, i := repo.branch(r.PathValue("branch"))
+	if i < 0 {
+		writeError(w, http.StatusUnprocessableEntity, "Reference does not exist")
+		return
+	}
+	repo.Branches = append(repo.Branches[:i], repo.Branches[i+1:]...)
+	writeNoContent(w)
+}
+
+// ------------------------------------------------------------------
+
+// listCommits lists the commits reachable from the "sha" query parameter
+// (a SHA or branch name, default: the default branch), newest first
+func (s *Server) listCommits(w http.ResponseWriter, r *http.Request) {
+	repo := s.repo(w, r)
+	if repo == nil {
+		return
+	}
+
+	ref := r.URL.Query().Get("sha")
+	if ref == "" && len(repo.Branches) > 0 {
+		ref = repo.Branches[0].Name
+	}
+
+	items := []interface{}{}
+	if _, head := repo.commit(ref); head >= 0 {
+		for i := head; i >= 0; i-- {
+			items = append(items, repo.renderCommit(repo.Commits[i]))
+		}
+	} else if ref != "" {
+		writeError(w, http.StatusNotFound, "No commit found for SHA: "+ref)
+		return
+	}
+	s.paginate(w, r, items)
+}
+
+func (s *Server) getCommit(w http.ResponseWriter, r *http.Request) {
+	repo := s.repo(w, r)
+	if repo == nil {
+		return
+	}
+
+	commit, _ := repo.commit(r.PathValue("ref"))
+	if commit == nil {
+		writeError(w, http.StatusUnprocessableEntity, "No commit found for SHA: "+r.PathValue("ref"))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, repo.renderCommit(commit))
+}
+
+// listStatuses lists the statuses of a commit, newest first
+func (s *Server) listStatuses(w http.ResponseWriter, r *http.Request) {
+	repo := s.repo(w, r)
+	if repo == nil {
+		return
+	}
+
+	items := []interface{}{}
+	if commit, _ := repo.commit(r.PathValue("ref")); commit != nil {
+		for i := len(commit.Statuses) - 1; i >= 0; i-- {
+			items = append(items, repo.renderStatus(commit.Statuses[i]))
+		}
+	}
+	s.paginate(w, r, items)
+}
+
+func (s *Server) createStatus(w http.ResponseWriter, r *http.Request) {
+	repo := s.repo(w, r)
+	if repo == nil {
+		return
+	}
+
+	commit, _ := repo.commit(r.PathValue("sha"))
+	if commit == nil {
+		writeError(w, http.StatusUnprocessableEntity, "No commit found for SHA: "+r.PathValue("sha"))
+		return
+	}
+
+	var data struct {
+		State       string `json:"state"`
+		TargetURL   string `json:"target_url"`
+		Description string `json:"description"`
+		Context     string `json:"context"`
+	}
+	if !readJSON(w, r, &data) {
+		return
+	}
+
+	switch data.State {
+	case "error", "failure", "pending", "success":
+	default:
+		writeError(
+			w,
+			http.StatusUnprocessableEntity,
+			"Validation Failed",
+			client.FieldError{Resource: "Status", Field: "state", Code: "custom", Message: "state is not included in the list"},
+		)
+		return
+	}
+
+	if data.Context == "" {
+		data.Context = "default"
+	}
+
+	s.nextID++
+	status := &Status{
+		ID:          s.nextID,
+		State:       data.State,
+		TargetURL:   data.TargetURL,
+		Description: data.Description,
+		Context:     data.Context,
+		Creator:     repo.Owner,
+		CreatedAt:   time.Now().UTC().Truncate(time.Second),
+	}
+	commit.Statuses = append(commit.Statuses, status)
+	writeJSON(w, r, http.StatusCreated, repo.renderStatus(status))
+}
+
+// ------------------------------------------------------------------
+
+func (s *Server) listPulls(w http.ResponseWriter, r *http.Request) {
+	repo := s.repo(w, r)
+	if repo == nil {
+		return
+	}
+
+	query := r.URL.Query()
+	state := query.Get("state")
+	if state == "" {
+		state = "open"
+	}
+
+	items := []interface{}{}
+	for _, issue := range repo.Issues {
+		if issue.Pull == nil ||
+			(state != "all" && issue.State != state) ||
+			(query.Get("base") != "" && issue.Pull.Base != query.Get("base")) {
+			continue
+		}
+		items = append(items, repo.renderPull(issue))
+	}
+	s.paginate(w, r, items)
+}
+
+func (s *Server) getPull(w http.ResponseWriter, r *http.Request) {
+	if repo, issue := s.issue(w, r, true); issue != nil {
+		writeJSON(w, r, http.StatusOK, repo.renderPull(issue))
+	}
+}
+
+func (s *Server) listPullCommits(w http.ResponseWriter, r *http.Request) {
+	repo, issue := s.issue(w, r, true)
+	if issue == nil {
+		return
+	}
+
+	items := []interface{}{}
+	for _, sha := range issue.Pull.Commits {
+		if commit, _ := repo.commit(sha); commit != nil {
+			items = append(items, repo.renderCommit(commit))
+		}
+	}
+	s.paginate(w, r, items)
+}
+
+func (s *Server) mergePull(w http.ResponseWriter, r *http.Request) {
+	_, issue := s.issue(w, r, true)
+	if issue == nil {
+		return
+	}
+
+	var data struct {
+		SHA string `json:"sha"`
+	}
+	if !readJSON(w, r, &data) {
+		return
+	}
+
+	head := ""
+	if n := len(issue.Pull.Commits); n > 0 {
+		head = issue.Pull.Commits[n-1]
+	}
+
+	switch {
+	case issue.Pull.Merged || issue.State != "open":
+		writeError(w, http.StatusMethodNotAllowed, "Pull Request is not mergeable")
+	case data.SHA != "" && data.SHA != head:
+		writeError(w, http.StatusConflict, "Head branch was modified. Review and try the merge again.")
+	default:
+		issue.Pull.Merged = true
+		issue.State = "closed"
+		issue.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+		writeJSON(w, r, http.StatusOK, jsonObject{"sha": head, "merged": true, "message": "Pull Request successfully merged"})
+	}
+}
+
+// ------------------------------------------------------------------
+
+// listIssues lists the issues (including pull requests) filtered
+// by the state, assignee ("none", "*" or a login) and creator
+// query parameters
+func (s *Server) listIssues(w http.ResponseWriter, r *http.Request) {
+	repo := s.repo(w, r)
+	if repo == nil {
+		return
+	}
+
+	query := r.URL.Query()
+	state := query.Get("state")
+	if state == "" {
+		state = "open"
+	}
+
+	items := []interface{}{}
+	for _, issue := range repo.Issues {
+		if (state != "all" && issue.State != state) ||
+			(query.Get("creator") != "" && issue.Author != query.Get("creator")) ||
+			!matchAssignee(issue, query.Get("assignee")) {
+			continue
+		}
+		items = append(items, repo.renderIssue(issue))
+	}
+	s.paginate(w, r, items)
+}
+
+func matchAssignee(issue *Issue, assignee string) bool {
+	switch assignee {
+	case "":
+		return true
+	case "none":
+		return len(issue.Assignees) == 0
+	case "*":
+		return len(issue.Assignees) > 0
+	}
+
+	for _, login := range issue.Assignees {
+		if login == assignee {
+			return true
+		}
+	}
+	return false
+}
+
+type issueData struct {
+	Title     *string   `json:"title"`
+	Body      *string   `json:"body"`
+	State     *string   `json:"state"`
+	Labels    *[]string `json:"labels"`
+	Assignees *[]string `json:"assignees"`
+}
+
+func (d issueData) apply(issue *Issue) {
+	if d.Title != nil {
+		issue.Title = *d.Title
+	}
+	if d.Body != nil {
+		issue.Body = *d.Body
+	}
+	if d.State != nil {
+		issue.State = *d.State
+	}
+	if d.Labels != nil {
+		issue.Labels = *d.Labels
+	}
+	if d.Assignees != nil {
+		issue.Assignees = *d.Assignees
+	}
+	issue.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+}
+
+func (s *Server) createIssue(w http.ResponseWriter, r *http.Request) {
+	repo := s.repo(w, r)
+	if repo == nil {
+		return
+	}
+
+	var data issueData
+	if !readJSON(w, r, &data) {
+		return
+	}
+	if data.Title == nil || *data.Title == "" {
+		writeError(
+			w,
+			http.StatusUnprocessableEntity,
+			"Validation Failed",
+			client.FieldError{Resource: "Issue", Field: "title", Code: "missing_field"},
+		)
+		return
+	}
+
+	issue := repo.addIssue("", "", repo.Owner)
+	data.apply(issue)
+	writeJSON(w, r, http.StatusCreated, repo.renderIssue(issue))
+}
+
+func (s *Server) getIssue(w http.ResponseWriter, r *http.Request) {
+	if repo, issue := s.issue(w, r, false); issue != nil {
+		writeJSON(w, r, http.StatusOK, repo.renderIssue(issue))
+	}
+}
+
+func (s *Server) editIssue(w http.ResponseWriter, r *http.Request) {
+	repo, issue := s.issue(w, r, false)
+	if issue == nil {
+		return
+	}
+
+	var data issueData
+	if !readJSON(w, r, &data) {
+		return
+	}
+	if data.State != nil && *data.State != "open" && *data.State != "closed" {
+		writeError(
+			w,
+			http.StatusUnprocessableEntity,
+			"Validation Failed",
+			client.FieldError{Resource: "Issue", Field: "state", Code: "invalid"},
+		)
+		return
+	}
+
+	data.apply(issue)
+	writeJSON(w, r, http.StatusOK, repo.renderIssue(issue))
+}
+
+// deleteIssueResource dispatches the DELETEs of /issues/:number/lock
+// and /issues/comments/:id, whose patterns are ambiguous
+func (s *Server) deleteIssueResource(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.PathValue("number") == "comments":
+		r.SetPathValue("id", r.PathValue("what"))
+		s.deleteComment(w, r)
+	case r.PathValue("what") == "lock":
+		s.lockIssue(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func (s *Server) lockIssue(w http.ResponseWriter, r *http.Request) {
+	if _, issue := s.issue(w, r, false); issue != nil {
+		issue.Locked = r.Method == "PUT"
+		writeNoContent(w)
+	}
+}
+
+func (s *Server) listComments(w http.ResponseWriter, r *http.Request) {
+	repo, issue := s.issue(w, r, false)
+	if issue == nil {
+		return
+	}
+
+	items := []interface{}{}
+	for _, comment := range issue.Comments {
+		items = append(items, repo.renderComment(comment))
+	}
+	s.paginate(w, r, items)
+}
+
+func (s *Server) createComment(w http.ResponseWriter, r *http.Request) {
+	repo, issue := s.issue(w, r, false)
+	if issue == nil {
+		return
+	}
+
+	var data struct {
+		Body string `json:"body"`
+	}
+	if !readJSON(w, r, &data) {
+		return
+	}
+	if data.Body == "" {
+		writeError(
+			w,
+			http.StatusUnprocessableEntity,
+			"Validation Failed",
+			client.FieldError{Resource: "IssueComment", Field: "body", Code: "missing_field"},
+		)
+		return
+	}
+
+	comment := repo.addComment(issue, repo.Owner, data.Body)
+	writeJSON(w, r, http.StatusCreated, repo.renderComment(comment))
+}
+
+func (s *Server) editComment(w http.ResponseWriter, r *http.Request) {
+	repo := s.repo(w, r)
+	if repo == nil {
+		return
+	}
+
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	issue, i := repo.comment(id)
+	if issue == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	var data struct {
+		Body string `json:"body"`
+	}
+	if !readJSON(w, r, &data) {
+		return
+	}
+
+	comment := issue.Comments[i]
+	comment.Body = data.Body
+	comment.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	writeJSON(w, r, http.StatusOK, repo.renderComment(comment))
+}
+
+func (s *Server) deleteComment(w http.ResponseWriter, r *http.Request) {
+	repo := s.repo(w, r)
+	if repo == nil {
+		return
+	}
+
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	issue, i := repo.comment(id)
+	if issue == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	issue.Comments = append(issue.Comments[:i], issue.Comments[i+1:]...)
+	writeNoContent(w)
+}
+
+// collaborator checks (GET), adds (PUT) or removes (DELETE) a collaborator
+func (s *Server) collaborator(w http.ResponseWriter, r *http.Request) {
+	repo := s.repo(w, r)
+	if repo == nil {
+		return
+	}
+
+	login := r.PathValue("login")
+	switch r.Method {
+	case "GET":
+		if !repo.Collaborators[login] {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+	case "PUT":
+		repo.Collaborators[login] = true
+	case "DELETE":
+		delete(repo.Collaborators, login)
+	}
+	writeNoContent(w)
+}
+
+// ------------------------------------------------------------------
+
+func (s *Server) getOrg(w http.ResponseWriter, r *http.Request) {
+	if org := s.org(w, r); org != nil {
+		writeJSON(w, r, http.StatusOK, org.render())
+	}
+}
+
+func (s *Server) listTeams(w http.ResponseWriter, r *http.Request) {
+	org := s.org(w, r)
+	if org == nil {
+		return
+	}
+
+	items := []interface{}{}
+	for _, team := range org.Teams {
+		items = append(items, org.renderTeam(team))
+	}
+	s.paginate(w, r, items)
+}
+
+func (s *Server) getTeam(w http.ResponseWriter, r *http.Request) {
+	if org, team := s.team(w, r); team != nil {
+		writeJSON(w, r, http.StatusOK, org.renderTeam(team))
+	}
+}
+
+func (s *Server) listMembers(w http.ResponseWriter, r *http.Request) {
+	_, team := s.team(w, r)
+	if team == nil {
+		return
+	}
+
+	role := r.URL.Query().Get("role")
+	items := []interface{}{}
+	for _, m := range team.Members {
+		if role == "" || role == "all" || role == m.Role {
+			items = append(items, s.renderUser(m.Login))
+		}
+	}
+	s.paginate(w, r, items)
+}
+
+// membership gets (GET), sets (PUT) or removes (DELETE) a team membership
+func (s *Server) membership(w http.ResponseWriter, r *http.Request) {
+	org, team := s.team(w, r)
+	if team == nil {
+		return
+	}
+
+	login := r.PathValue("login")
+	switch r.Method {
+	case "GET":
+		m, _ := team.member(login)
+		if m == nil {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		writeJSON(w, r, http.StatusOK, org.renderMembership(team, m))
+
+	case "PUT":
+		var data struct {
+			Role string `json:"role"`
+		}
+		if !readJSON(w, r, &data) {
+			return
+		}
+		m := team.setMember(login, data.Role)
+		writeJSON(w, r, http.StatusOK, org.renderMembership(team, m))
+
+	case "DELETE":
+		if _, i := team.member(login); i >= 0 {
+			team.Members = append(team.Members[:i], team.Members[i+1:]...)
+		}
+		writeNoContent(w)
+	}
+}
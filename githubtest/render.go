@@ -0,0 +1,186 @@
+package githubtest
+
+import (
+	"fmt"
+	"time"
+)
+
+// JSON representations of the fake entities, following
+// the fields of the real Github API used by this library
+
+type jsonObject map[string]interface{}
+
+func (s *Server) renderUser(login string) jsonObject {
+	if login == "" {
+		return nil
+	}
+	return jsonObject{
+		"login": login,
+		"id":    s.userID(login),
+		"url":   fmt.Sprintf("%s/users/%s", s.URL, login),
+	}
+}
+
+func (s *Server) renderUsers(logins []string) []jsonObject {
+	users := []jsonObject{}
+	for _, login := range logins {
+		users = append(users, s.renderUser(login))
+	}
+	return users
+}
+
+func (r *Repo) url(suffix string, args ...interface{}) string {
+	return fmt.Sprintf("%s/repos/%s/%s", r.srv.URL, r.Owner, r.Name) + fmt.Sprintf(suffix, args...)
+}
+
+func (r *Repo) htmlURL(suffix string, args ...interface{}) string {
+	return fmt.Sprintf("https://github.test/%s/%s", r.Owner, r.Name) + fmt.Sprintf(suffix, args...)
+}
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// ------------------------------------------------------------------
+
+func (r *Repo) renderCommit(c *Commit) jsonObject {
+	return jsonObject{
+		"sha":       c.SHA,
+		"url":       r.url("/commits/%s", c.SHA),
+		"html_url":  r.htmlURL("/commit/%s", c.SHA),
+		"author":    r.srv.renderUser(c.Author),
+		"committer": r.srv.renderUser(c.Author),
+		"commit": jsonObject{
+			"message": c.Message,
+			"committer": jsonObject{
+				"name":  c.Author,
+				"email": c.Author + "@users.noreply.github.test",
+				"date":  timestamp(c.Date),
+			},
+		},
+	}
+}
+
+func (r *Repo) renderBranch(b *Branch) jsonObject {
+	branch := jsonObject{"name": b.Name}
+	if commit, _ := r.commit(b.SHA); commit != nil {
+		branch["commit"] = r.renderCommit(commit)
+	}
+	return branch
+}
+
+func (r *Repo) renderStatus(st *Status) jsonObject {
+	return jsonObject{
+		"id":          st.ID,
+		"state":       st.State,
+		"target_url":  st.TargetURL,
+		"description": st.Description,
+		"context":     st.Context,
+		"creator":     r.srv.renderUser(st.Creator),
+		"created_at":  timestamp(st.CreatedAt),
+		"updated_at":  timestamp(st.CreatedAt),
+	}
+}
+
+func (r *Repo) renderIssue(i *Issue) jsonObject {
+	issue := jsonObject{
+		"number":     i.Number,
+		"url":        r.url("/issues/%d", i.Number),
+		"html_url":   r.htmlURL("/issues/%d", i.Number),
+		"state":      i.State,
+		"title":      i.Title,
+		"body":       i.Body,
+		"user":       r.srv.renderUser(i.Author),
+		"assignees":  r.srv.renderUsers(i.Assignees),
+		"locked":     i.Locked,
+		"comments":   len(i.Comments),
+		"created_at": timestamp(i.CreatedAt),
+		"updated_at": timestamp(i.UpdatedAt),
+	}
+
+	labels := []jsonObject{}
+	for _, label := range i.Labels {
+		labels = append(labels, jsonObject{"name": label})
+	}
+	issue["labels"] = labels
+
+	if len(i.Assignees) > 0 {
+		issue["assignee"] = r.srv.renderUser(i.Assignees[0])
+	}
+	if i.State == "closed" {
+		issue["closed_at"] = timestamp(i.UpdatedAt)
+	}
+	if i.Pull != nil {
+		issue["pull_request"] = jsonObject{"url": r.url("/pulls/%d", i.Number)}
+	}
+	return issue
+}
+
+func (r *Repo) renderPull(i *Issue) jsonObject {
+	pull := r.renderIssue(i)
+	delete(pull, "pull_request")
+	pull["url"] = r.url("/pulls/%d", i.Number)
+	pull["html_url"] = r.htmlURL("/pull/%d", i.Number)
+	pull["merged"] = i.Pull.Merged
+	pull["base"] = jsonObject{"ref": i.Pull.Base}
+
+	head := jsonObject{"ref": i.Pull.Head}
+	if n := len(i.Pull.Commits); n > 0 {
+		head["sha"] = i.Pull.Commits[n-1]
+	}
+	pull["head"] = head
+	return pull
+}
+
+func (r *Repo) renderComment(c *Comment) jsonObject {
+	return jsonObject{
+		"id":         c.ID,
+		"url":        r.url("/issues/comments/%d", c.ID),
+		"body":       c.Body,
+		"user":       r.srv.renderUser(c.Author),
+		"created_at": timestamp(c.CreatedAt),
+		"updated_at": timestamp(c.UpdatedAt),
+	}
+}
+
+// ------------------------------------------------------------------
+
+func (o *Org) url(suffix string, args ...interface{}) string {
+	return fmt.Sprintf("%s/orgs/%s", o.srv.URL, o.Login) + fmt.Sprintf(suffix, args...)
+}
+
+func (o *Org) render() jsonObject {
+	return jsonObject{
+		"id":          o.ID,
+		"login":       o.Login,
+		"name":        o.Name,
+		"description": o.Description,
+		"url":         o.url(""),
+		"html_url":    "https://github.test/" + o.Login,
+	}
+}
+
+// teamURL returns the URL of the team, which Github
+// gives by IDs rather than by organisation login and slug
+func (o *Org) teamURL(t *Team) string {
+	return fmt.Sprintf("%s/organizations/%d/team/%d", o.srv.URL, o.ID, t.ID)
+}
+
+func (o *Org) renderTeam(t *Team) jsonObject {
+	return jsonObject{
+		"id":            t.ID,
+		"url":           o.teamURL(t),
+		"name":          t.Name,
+		"slug":          t.Slug,
+		"members_count": len(t.Members),
+		"organization":  o.render(),
+	}
+}
+
+func (o *Org) renderMembership(t *Team, m *Membership) jsonObject {
+	return jsonObject{
+		"url":   o.teamURL(t) + "/memberships/" + m.Login,
+		"role":  m.Role,
+		"state": "active",
+	}
+}
@@ -0,0 +1,315 @@
+// Package githubtest provides an in-process fake of the subset of the
+// Github REST API used by this library (repositories, branches, commits,
+// statuses, pull requests, issues, comments, organisations, teams and
+// memberships), for testing code built on top of it without the network.
+//
+// The fake keeps its state in memory, paginates lists with Link headers,
+// answers conditional GETs with 304 Not Modified, and can be told to fail
+// requests on demand:
+//
+//	srv := githubtest.NewServer()
+//	defer srv.Close()
+//
+//	repo := srv.AddRepo("octo", "hello")
+//	repo.AddIssue("Something is broken", "alice")
+//
+//	session := object.NewSession(srv.Client())
+//	issues, _ := session.Repo("octo", "hello").Issues("open", "", "", true)
+package githubtest
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brinick/github/client"
+	"github.com/brinick/github/client/cachedclient"
+)
+
+// DefaultPerPage is the default number of items per page of results,
+// as for the real Github API
+const DefaultPerPage = 30
+
+// Token is the token used by the clients returned by Server.Client
+const Token = "githubtest-token"
+
+// ------------------------------------------------------------------
+
+// Server is a fake Github API server. Its exported seeding methods
+// may be called at any time; the entities they return must however
+// not be modified while requests are in flight.
+type Server struct {
+	*httptest.Server
+
+	// PerPage is the default number of items per page of results
+	PerPage int
+
+	mu        sync.Mutex
+	mux       *http.ServeMux
+	repos     map[string]*Repo
+	orgs      map[string]*Org
+	users     map[string]int
+	faults    []*Fault
+	nRequests int
+	nextID    int
+}
+
+// NewServer creates and starts a new fake Github API server
+func NewServer() *Server {
+	s := &Server{
+		PerPage: DefaultPerPage,
+		repos:   map[string]*Repo{},
+		orgs:    map[string]*Org{},
+		users:   map[string]int{},
+	}
+	s.mux = s.routes()
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// BaseURL returns the REST API base URL of the server
+func (s *Server) BaseURL() string {
+	return s.URL
+}
+
+// Client creates a new cached client talking to this server, authorised
+// with Token and using a fresh in-memory cache. Retries of transient failures are
+// made without noticeable delay. The given options are applied last.
+func (s *Server) Client(opts ...cachedclient.Option) *cachedclient.PickledCachedClient {
+	retry := cachedclient.DefaultRetryPolicy
+	retry.BaseDelay = time.Millisecond
+	retry.MaxDelay = 10 * time.Millisecond
+
+	defaults := []cachedclient.Option{
+		cachedclient.WithBaseURL(s.URL),
+		cachedclient.WithToken(staticToken(Token)),
+		cachedclient.WithCache(cachedclient.NewMemoryCache()),
+		cachedclient.WithRetryPolicy(retry),
+	}
+	return cachedclient.NewClient(append(defaults, opts...)...)
+}
+
+// Requests returns the number of requests received by the server so far
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nRequests
+}
+
+// ------------------------------------------------------------------
+
+type staticToken string
+
+func (t staticToken) LoadToken() string { return string(t) }
+func (t staticToken) Token() string     { return string(t) }
+
+// ------------------------------------------------------------------
+
+// Fault describes requests that the server should fail
+type Fault struct {
+	// Method and Path select the requests affected by the fault.
+	// Empty values match any method; Path is a prefix of the URL path.
+	Method string
+	Path   string
+
+	// StatusCode, Header and Body make up the returned response.
+	// A zero StatusCode closes the connection instead of responding.
+	StatusCode int
+	Header     map[string]string
+	Body       string
+
+	// Times is the number of requests to fail; zero or less means all
+	Times int
+}
+
+func (f *Fault) matches(r *http.Request) bool {
+	return (f.Method == "" || f.Method == r.Method) && strings.HasPrefix(r.URL.Path, f.Path)
+}
+
+// InjectFault makes the server fail the requests matching the fault,
+// until it has done so the given number of times
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes all injected faults
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// fault returns the injected fault matching the request, if any
+func (s *Server) fault(r *http.Request) *Fault {
+	for i, f := range s.faults {
+		if !f.matches(r) {
+			continue
+		}
+
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+func writeFault(w http.ResponseWriter, f *Fault) {
+	if f.StatusCode == 0 {
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		f.StatusCode = http.StatusBadGateway
+	}
+
+	for key, val := range f.Header {
+		w.Header().Set(key, val)
+	}
+	w.WriteHeader(f.StatusCode)
+	w.Write([]byte(f.Body))
+}
+
+// ------------------------------------------------------------------
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nRequests++
+	if f := s.fault(r); f != nil {
+		writeFault(w, f)
+		return
+	}
+
+	w.Header().Set("X-RateLimit-Limit", "5000")
+	w.Header().Set("X-RateLimit-Remaining", "4999")
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+
+	if r.Header.Get("Authorization") == "" {
+		writeError(w, http.StatusUnauthorized, "Requires authentication")
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+// ------------------------------------------------------------------
+
+// writeJSON writes the value as the JSON response body. Successful GETs
+// carry an ETag, and conditional ones are answered with 304 if the
+// resource did not change.
+func writeJSON(w http.ResponseWriter, r *http.Request, statusCode int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if r.Method == "GET" && statusCode == http.StatusOK {
+		etag := fmt.Sprintf(`"%x"`, sha1.Sum(append(body, w.Header().Get("Link")...)))
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+// writeError writes a Github-like error response
+func writeError(w http.ResponseWriter, statusCode int, message string, fieldErrors ...client.FieldError) {
+	body := map[string]interface{}{
+		"message":           message,
+		"documentation_url": "https://docs.github.com/rest",
+	}
+	if len(fieldErrors) > 0 {
+		body["errors"] = fieldErrors
+	}
+
+	data, _ := json.Marshal(body)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	w.Write(data)
+}
+
+func writeNoContent(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readJSON decodes the JSON request body (if any) into the value pointed
+// to by v, writing an error response and returning false if it is invalid
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+		return false
+	}
+	return true
+}
+
+// ------------------------------------------------------------------
+
+// paginate writes the page of items selected by the page/per_page
+// query parameters, with a Link header to the next and last pages
+func (s *Server) paginate(w http.ResponseWriter, r *http.Request, items []interface{}) {
+	query := r.URL.Query()
+	perPage := s.PerPage
+	if n, err := strconv.Atoi(query.Get("per_page")); err == nil && n > 0 {
+		perPage = n
+	}
+	page := 1
+	if n, err := strconv.Atoi(query.Get("page")); err == nil && n > 0 {
+		page = n
+	}
+
+	lastPage := (len(items) + perPage - 1) / perPage
+	if lastPage == 0 {
+		lastPage = 1
+	}
+
+	start := (page - 1) * perPage
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + perPage
+	if end > len(items) {
+		end = len(items)
+	}
+
+	if page < lastPage {
+		w.Header().Set(
+			"Link",
+			fmt.Sprintf(
+				`<%s>; rel="next", <%s>; rel="last"`,
+				s.pageURL(r, page+1, perPage),
+				s.pageURL(r, lastPage, perPage),
+			),
+		)
+	}
+
+	writeJSON(w, r, http.StatusOK, items[start:end])
+}
+
+func (s *Server) pageURL(r *http.Request, page, perPage int) string {
+	query := r.URL.Query()
+	query.Set("page", strconv.Itoa(page))
+	query.Set("per_page", strconv.Itoa(perPage))
+	return s.URL + r.URL.Path + "?" + query.Encode()
+}
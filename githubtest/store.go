@@ -0,0 +1,340 @@
+package githubtest
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"time"
+)
+
+// ------------------------------------------------------------------
+
+// Repo is a fake repository
+type Repo struct {
+	Owner         string
+	Name          string
+	Branches      []*Branch
+	Commits       []*Commit // oldest first
+	Issues        []*Issue  // including pull requests
+	Collaborators map[string]bool
+	Starred       bool
+
+	srv *Server
+}
+
+// Branch is a fake repository branch
+type Branch struct {
+	Name string
+	SHA  string
+}
+
+// Commit is a fake repository commit
+type Commit struct {
+	SHA      string
+	Message  string
+	Author   string
+	Date     time.Time
+	Statuses []*Status
+}
+
+// Status is a fake commit status
+type Status struct {
+	ID          int
+	State       string
+	TargetURL   string
+	Description string
+	Context     string
+	Creator     string
+	CreatedAt   time.Time
+}
+
+// Issue is a fake repository issue, or pull request if Pull is not nil
+type Issue struct {
+	Number    int
+	Title     string
+	Body      string
+	State     string
+	Author    string
+	Assignees []string
+	Labels    []string
+	Locked    bool
+	Comments  []*Comment
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Pull      *Pull
+}
+
+// Pull holds the pull request specifics of an Issue
+type Pull struct {
+	Base    string
+	Head    string
+	Commits []string // SHAs, oldest first
+	Merged  bool
+}
+
+// Comment is a fake issue comment
+type Comment struct {
+	ID        int
+	Author    string
+	Body      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Org is a fake organisation
+type Org struct {
+	ID          int
+	Login       string
+	Name        string
+	Description string
+	Teams       []*Team
+
+	srv *Server
+}
+
+// Team is a fake organisation team
+type Team struct {
+	ID      int
+	Slug    string
+	Name    string
+	Members []*Membership
+}
+
+// Membership is the membership of a user in a team
+type Membership struct {
+	Login string
+	Role  string // "member" or "maintainer"
+}
+
+// ------------------------------------------------------------------
+
+// AddRepo creates a new empty repository
+func (s *Server) AddRepo(owner, name string) *Repo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo := &Repo{
+		Owner:         owner,
+		Name:          name,
+		Collaborators: map[string]bool{owner: true},
+		srv:           s,
+	}
+	s.repos[owner+"/"+name] = repo
+	return repo
+}
+
+// Repo returns the repository with the given owner and name, or nil
+func (s *Server) Repo(owner, name string) *Repo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.repos[owner+"/"+name]
+}
+
+// AddCommit adds a commit on top of the repository history, moving
+// the default branch (created if need be) to point to it
+func (r *Repo) AddCommit(message, author string) *Commit {
+	r.srv.mu.Lock()
+	defer r.srv.mu.Unlock()
+
+	commit := &Commit{
+		SHA:     fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprintf("%s/%s#%d", r.Owner, r.Name, len(r.Commits))))),
+		Message: message,
+		Author:  author,
+		Date:    time.Now().UTC().Truncate(time.Second),
+	}
+	r.Commits = append(r.Commits, commit)
+
+	if len(r.Branches) == 0 {
+		r.Branches = append(r.Branches, &Branch{Name: "master"})
+	}
+	r.Branches[0].SHA = commit.SHA
+	return commit
+}
+
+// AddBranch creates a branch pointing at the commit with the given SHA
+func (r *Repo) AddBranch(name, sha string) *Branch {
+	r.srv.mu.Lock()
+	defer r.srv.mu.Unlock()
+
+	branch := &Branch{Name: name, SHA: sha}
+	r.Branches = append(r.Branches, branch)
+	return branch
+}
+
+// AddIssue opens a new issue
+func (r *Repo) AddIssue(title, author string) *Issue {
+	r.srv.mu.Lock()
+	defer r.srv.mu.Unlock()
+	return r.addIssue(title, "", author)
+}
+
+// AddPull opens a new pull request merging the commits with the given SHAs
+// into the base branch. The last commit is the head of the pull request.
+func (r *Repo) AddPull(title, author, base string, shas ...string) *Issue {
+	r.srv.mu.Lock()
+	defer r.srv.mu.Unlock()
+
+	issue := r.addIssue(title, "", author)
+	issue.Pull = &Pull{Base: base, Head: "feature-" + fmt.Sprint(issue.Number), Commits: shas}
+	return issue
+}
+
+// AddComment adds a comment to the issue
+func (r *Repo) AddComment(issue *Issue, author, body string) *Comment {
+	r.srv.mu.Lock()
+	defer r.srv.mu.Unlock()
+	return r.addComment(issue, author, body)
+}
+
+func (r *Repo) addIssue(title, body, author string) *Issue {
+	now := time.Now().UTC().Truncate(time.Second)
+	issue := &Issue{
+		Number:    len(r.Issues) + 1,
+		Title:     title,
+		Body:      body,
+		State:     "open",
+		Author:    author,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	r.Issues = append(r.Issues, issue)
+	return issue
+}
+
+func (r *Repo) addComment(issue *Issue, author, body string) *Comment {
+	r.srv.nextID++
+	now := time.Now().UTC().Truncate(time.Second)
+	comment := &Comment{
+		ID:        r.srv.nextID,
+		Author:    author,
+		Body:      body,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	issue.Comments = append(issue.Comments, comment)
+	return comment
+}
+
+func (r *Repo) issue(number int) *Issue {
+	if number < 1 || number > len(r.Issues) {
+		return nil
+	}
+	return r.Issues[number-1]
+}
+
+func (r *Repo) comment(id int) (*Issue, int) {
+	for _, issue := range r.Issues {
+		for i, comment := range issue.Comments {
+			if comment.ID == id {
+				return issue, i
+			}
+		}
+	}
+	return nil, -1
+}
+
+func (r *Repo) branch(name string) (*Branch, int) {
+	for i, branch := range r.Branches {
+		if branch.Name == name {
+			return branch, i
+		}
+	}
+	return nil, -1
+}
+
+// commit returns the commit with the given SHA, or at the head of the
+// branch with the given name, along with its index in the history
+func (r *Repo) commit(ref string) (*Commit, int) {
+	if branch, _ := r.branch(ref); branch != nil {
+		ref = branch.SHA
+	}
+	for i, commit := range r.Commits {
+		if commit.SHA == ref {
+			return commit, i
+		}
+	}
+	return nil, -1
+}
+
+// ------------------------------------------------------------------
+
+// AddOrg creates a new organisation
+func (s *Server) AddOrg(login string) *Org {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	org := &Org{ID: s.nextID, Login: login, Name: login, srv: s}
+	s.orgs[login] = org
+	return org
+}
+
+// Org returns the organisation with the given login, or nil
+func (s *Server) Org(login string) *Org {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.orgs[login]
+}
+
+// AddTeam creates a new team in the organisation
+func (o *Org) AddTeam(slug, name string) *Team {
+	o.srv.mu.Lock()
+	defer o.srv.mu.Unlock()
+
+	o.srv.nextID++
+	team := &Team{ID: o.srv.nextID, Slug: slug, Name: name}
+	o.Teams = append(o.Teams, team)
+	return team
+}
+
+// AddMember adds the user to the team with the given role
+func (o *Org) AddMember(team *Team, login, role string) {
+	o.srv.mu.Lock()
+	defer o.srv.mu.Unlock()
+	team.setMember(login, role)
+}
+
+func (o *Org) team(slug string) *Team {
+	for _, team := range o.Teams {
+		if team.Slug == slug {
+			return team
+		}
+	}
+	return nil
+}
+
+func (t *Team) member(login string) (*Membership, int) {
+	for i, m := range t.Members {
+		if m.Login == login {
+			return m, i
+		}
+	}
+	return nil, -1
+}
+
+func (t *Team) setMember(login, role string) *Membership {
+	if role == "" {
+		role = "member"
+	}
+	if m, _ := t.member(login); m != nil {
+		m.Role = role
+		return m
+	}
+
+	m := &Membership{Login: login, Role: role}
+	t.Members = append(t.Members, m)
+	return m
+}
+
+// ------------------------------------------------------------------
+
+// userID returns the ID of the user with the given login,
+// allocating one the first time the user is seen
+func (s *Server) userID(login string) int {
+	id, found := s.users[login]
+	if !found {
+		s.nextID++
+		id = s.nextID
+		s.users[login] = id
+	}
+	return id
+}
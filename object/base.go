@@ -3,19 +3,16 @@ package object
 import (
 	"encoding/json"
 	"fmt"
-	"path/filepath"
 	"reflect"
+	"strings"
 
 	"github.com/brinick/github/client"
-	"github.com/brinick/github/client/cachedclient"
 	"github.com/brinick/logging"
 )
 
 // ------------------------------------------------------------------
 
 var (
-	cachedClient *cachedclient.PickledCachedClient
-	// HTTPClient   = cachedclient.NewClient()
 	PageIterator = client.NewGithubPageIterator
 
 	// Error returned by an iterator when there is no next page
@@ -26,14 +23,6 @@ var (
 // NotAvailable is just this constant...
 const NotAvailable = "<n/a>"
 
-func HTTPClient() *cachedclient.PickledCachedClient {
-	if cachedClient == nil {
-		cachedClient = cachedclient.NewClient()
-	}
-
-	return cachedClient
-}
-
 // ------------------------------------------------------------------
 // Utility functions
 // ------------------------------------------------------------------
@@ -54,6 +43,16 @@ func parseJSON(data string, object interface{}) error {
 	return err
 }
 
+// decodeResponse parses the JSON body of the response to a write
+// operation into the value pointed to by the object, unless
+// the operation failed with the given error.
+func decodeResponse(resp *client.Response, err error, object interface{}) error {
+	if err != nil {
+		return err
+	}
+	return parseJSON(string(resp.Body), object)
+}
+
 // ------------------------------------------------------------------
 
 func format(template string, values ...interface{}) string {
@@ -62,9 +61,22 @@ func format(template string, values ...interface{}) string {
 
 // ------------------------------------------------------------------
 
-// join makes a path from the fragments passed
+// join makes a URL (or path) from the fragments passed,
+// with a single slash between each of them
 func join(bits ...string) string {
-	return filepath.Join(bits...)
+	parts := make([]string, 0, len(bits))
+	for i, bit := range bits {
+		if i > 0 {
+			bit = strings.TrimLeft(bit, "/")
+		}
+		if i < len(bits)-1 {
+			bit = strings.TrimRight(bit, "/")
+		}
+		if bit != "" {
+			parts = append(parts, bit)
+		}
+	}
+	return strings.Join(parts, "/")
 }
 
 // ------------------------------------------------------------------
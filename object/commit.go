@@ -2,98 +2,24 @@ package object
 
 import (
 	"context"
-	"fmt"
-	"github.com/brinick/github/client"
+	"errors"
+	"strings"
 	"time"
 )
 
+// ErrStatusExists is returned when setting a commit status
+// that the commit already has
+var ErrStatusExists = errors.New("Status already exists")
+
 // ------------------------------------------------------------------
 
 type CommitsGetter interface {
-	Commits() (*commitsIterator, error)
+	Commits() (*Iterator[*RepoCommit], error)
 	Commit(string) (*RepoCommit, error)
 }
 
 // ------------------------------------------------------------------
 
-type commitsIterator struct {
-	Err          error
-	it           client.PageIterator
-	currentPage  []*RepoCommit
-	current      *RepoCommit
-	currentIndex int
-}
-
-func (i *commitsIterator) Item() *RepoCommit {
-	return i.current
-}
-
-func (i *commitsIterator) HasNext() bool {
-	i.NextWithContext(context.TODO())
-	return i.current != nil
-}
-
-func (i *commitsIterator) HasNextWithContext(ctx context.Context) bool {
-	i.NextWithContext(ctx)
-	select {
-	case <-ctx.Done():
-		i.Err = ctx.Err()
-		return false
-	default:
-		return i.current != nil
-	}
-}
-
-func (i *commitsIterator) Next() {
-	i.NextWithContext(context.TODO())
-}
-
-func (i *commitsIterator) NextWithContext(ctx context.Context) {
-	if i.Err != nil {
-		i.current = nil
-		return
-	}
-
-	if i.currentPage == nil || i.currentIndex == len(i.currentPage) {
-		if err := i.load(ctx); err != nil {
-			i.current = nil
-			return
-		}
-	}
-
-	i.current = i.currentPage[i.currentIndex]
-	i.currentIndex++
-}
-
-func (i *commitsIterator) load(ctx context.Context) error {
-	var err error
-	i.currentPage, err = i.nextPage(ctx)
-	if err != nil && err != NoMorePages {
-		i.Err = err
-	} else {
-		i.currentIndex = 0
-	}
-
-	return err
-}
-
-func (i *commitsIterator) nextPage(ctx context.Context) ([]*RepoCommit, error) {
-	var items []*RepoCommit
-	page := i.it.NextWithContext(ctx)
-	if page == nil || page.NoContent() {
-		// page is nil, no results
-		return nil, NoMorePages
-	}
-
-	if page.Err == nil {
-		parseJSON(page.Content.Data, &items)
-	}
-
-	return items, i.it.Error()
-}
-
-// ------------------------------------------------------------------
-
 // RepoCommit is a repository commit
 type RepoCommit struct {
 	SHA       string `json:"sha,omitempty"`
@@ -105,6 +31,8 @@ type RepoCommit struct {
 	Commit    *innerCommit  `json:"commit,omitempty"`
 	Stats     *CommitStats  `json:"stats,omitempty"`
 	Files     []*CommitFile `json:"files,omitempty"`
+
+	session *Session
 }
 
 type innerCommit struct {
@@ -135,17 +63,28 @@ type CommitFile struct {
 
 // ------------------------------------------------------------------
 
+func (c *RepoCommit) bind(s *Session) {
+	if c != nil {
+		c.session = s
+	}
+}
+
+// Session returns the session this commit was obtained from
+func (c *RepoCommit) Session() *Session {
+	return sessionOrDefault(c.session)
+}
+
 // Statuses retrieves the list of statuses associated with the commit
-func (c *RepoCommit) Statuses() (*commitStatusesIterator, error) {
+func (c *RepoCommit) Statuses() (*Iterator[*CommitStatus], error) {
 	url := format("%s/%s", c.URL, "statuses")
-	it := PageIterator(url, HTTPClient())
-	return &commitStatusesIterator{it: it}, nil
+	return newIterator[*CommitStatus](c.Session(), url), nil
 
 }
 
 // HasStatus checks if the commit has the exact commit status passed in
 func (c *RepoCommit) HasStatus(cs *CommitStatus) bool {
 	statuses, _ := c.Statuses()
+	defer statuses.Close()
 
 	for statuses.HasNext() {
 		if statuses.Item().Equal(cs) {
@@ -157,21 +96,29 @@ func (c *RepoCommit) HasStatus(cs *CommitStatus) bool {
 }
 
 // SetStatusWithContext creates the given status via HTTP POST,
-// returning the HTTP status code
-func (c *RepoCommit) SetStatusWithContext(ctx context.Context, status *CommitStatus) (int, error) {
+// returning the status as stored by Github
+func (c *RepoCommit) SetStatusWithContext(ctx context.Context, status *CommitStatus) (*CommitStatus, error) {
 	if c.HasStatus(status) {
-		return 0, fmt.Errorf("Status already exists")
+		return nil, ErrStatusExists
 	}
 
-	url := format("%s/%s", c.URL, "statuses")
-	fmt.Println(url)
-
-	return HTTPClient().PostWithContext(ctx, url, true, status.toDict())
+	// statuses are created at /repos/:owner/:repo/statuses/:sha,
+	// while the commit URL is /repos/:owner/:repo/commits/:sha
+	var created *CommitStatus
+	url := c.URL
+	if i := strings.LastIndex(url, "/commits/"); i >= 0 {
+		url = url[:i] + "/statuses/" + url[i+len("/commits/"):]
+	}
+	resp, err := c.Session().client.PostWithContext(ctx, url, true, status.Request())
+	if err := decodeResponse(resp, err, &created); err != nil {
+		return nil, err
+	}
+	return created, nil
 }
 
 // SetStatus creates the given status via HTTP POST,
-// returning the HTTP status code
-func (c *RepoCommit) SetStatus(status *CommitStatus) (int, error) {
+// returning the status as stored by Github
+func (c *RepoCommit) SetStatus(status *CommitStatus) (*CommitStatus, error) {
 	return c.SetStatusWithContext(context.TODO(), status)
 }
 
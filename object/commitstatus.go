@@ -1,88 +1,6 @@
 package object
 
-import (
-	"context"
-	"github.com/brinick/github/client"
-	"reflect"
-)
-
-type commitStatusesIterator struct {
-	Err          error
-	it           client.PageIterator
-	currentPage  []*CommitStatus
-	current      *CommitStatus
-	currentIndex int
-}
-
-func (i *commitStatusesIterator) Item() *CommitStatus {
-	return i.current
-}
-
-func (i *commitStatusesIterator) HasNext() bool {
-	i.NextWithContext(context.TODO())
-	return i.current != nil
-}
-
-func (i *commitStatusesIterator) HasNextWithContext(ctx context.Context) bool {
-	i.NextWithContext(ctx)
-	select {
-	case <-ctx.Done():
-		i.Err = ctx.Err()
-		return false
-	default:
-		return i.current != nil
-	}
-}
-
-func (i *commitStatusesIterator) Next() {
-	i.NextWithContext(context.TODO())
-}
-
-func (i *commitStatusesIterator) NextWithContext(ctx context.Context) {
-	if i.Err != nil {
-		i.current = nil
-		return
-	}
-
-	if i.currentPage == nil || i.currentIndex == len(i.currentPage) {
-		if err := i.load(ctx); err != nil {
-			i.current = nil
-			return
-		}
-	}
-
-	i.current = i.currentPage[i.currentIndex]
-	i.currentIndex++
-}
-
-func (i *commitStatusesIterator) load(ctx context.Context) error {
-	var err error
-	i.currentPage, err = i.nextPage(ctx)
-	if err != nil && err != NoMorePages {
-		i.Err = err
-	} else {
-		i.currentIndex = 0
-	}
-
-	return err
-}
-
-func (i *commitStatusesIterator) nextPage(ctx context.Context) ([]*CommitStatus, error) {
-	var items []*CommitStatus
-	page := i.it.NextWithContext(ctx)
-	if page == nil || page.NoContent() {
-		// page is nil, no results
-		return nil, NoMorePages
-	}
-
-	if page.Err == nil {
-		parseJSON(page.Content.Data, &items)
-	}
-
-	return items, i.it.Error()
-}
-
-// ------------------------------------------------------------------
+import "reflect"
 
 // CommitStatus is a status associated with a commit
 type CommitStatus struct {
@@ -95,8 +13,26 @@ type CommitStatus struct {
 	UpdatedAt   string `json:"updated_at,omitempty"`
 }
 
-// Get a map representation of this commit status that
-// can be used for updating the parent commit in the repository
+// CommitStatusRequest holds the fields to set when creating a commit status
+type CommitStatusRequest struct {
+	State       string `json:"state"`
+	TargetURL   string `json:"target_url,omitempty"`
+	Description string `json:"description,omitempty"`
+	Context     string `json:"context,omitempty"`
+}
+
+// Request returns the request creating this commit status
+func (cs CommitStatus) Request() *CommitStatusRequest {
+	return &CommitStatusRequest{
+		State:       cs.State,
+		TargetURL:   cs.TargetURL,
+		Description: cs.Description,
+		Context:     cs.Context,
+	}
+}
+
+// Get a map representation of this commit status
+// that can be used to compare it with others
 func (cs CommitStatus) toDict() map[string]string {
 	return map[string]string{
 		"state":       cs.State,
@@ -4,87 +4,26 @@ import (
 	"context"
 	"path/filepath"
 	"time"
-
-	"github.com/brinick/github/client"
 )
 
 // ------------------------------------------------------------------
 
-type issuesIterator struct {
-	Err          error
-	it           client.PageIterator
-	currentPage  []*RepoIssue
-	current      *RepoIssue
-	currentIndex int
-}
-
-func (i *issuesIterator) Item() *RepoIssue {
-	return i.current
-}
-
-func (i *issuesIterator) HasNext() bool {
-	i.NextWithContext(context.TODO())
-	return i.current != nil
-}
-
-func (i *issuesIterator) HasNextWithContext(ctx context.Context) bool {
-	i.NextWithContext(ctx)
-	return i.current != nil
-}
-
-func (i *issuesIterator) Next() {
-	i.NextWithContext(context.TODO())
-}
-
-func (i *issuesIterator) NextWithContext(ctx context.Context) {
-	if i.Err != nil {
-		i.current = nil
-		return
-	}
-
-	if i.currentPage == nil || i.currentIndex == len(i.currentPage) {
-		if err := i.load(ctx); err != nil {
-			i.current = nil
-			return
-		}
-	}
-
-	i.current = i.currentPage[i.currentIndex]
-	i.currentIndex++
-}
-
-func (i *issuesIterator) load(ctx context.Context) error {
-	var err error
-	i.currentPage, err = i.nextPage(ctx)
-	if err != nil && err != NoMorePages {
-		i.Err = err
-	} else {
-		i.currentIndex = 0
-	}
-
-	return err
-}
-
-func (i *issuesIterator) nextPage(ctx context.Context) ([]*RepoIssue, error) {
-	var items []*RepoIssue
-	page := i.it.NextWithContext(ctx)
-	if page == nil || page.NoContent() {
-		// page is nil, no results
-		return nil, NoMorePages
-	}
-
-	if page.Err == nil {
-		parseJSON(page.Content.Data, &items)
-	}
-
-	return items, i.it.Error()
+type IssuesGetter interface {
+	Issues(string, string, string, bool) (*Iterator[*RepoIssue], error)
+	Issue(int) (*RepoIssue, error)
 }
 
 // ------------------------------------------------------------------
 
-type IssuesGetter interface {
-	Issues(string, string, string, bool) (*issuesIterator, error)
-	Issue(int) (*RepoIssue, error)
+// IssueRequest holds the fields to set when creating or editing an issue.
+// Nil/empty fields are left unchanged.
+type IssueRequest struct {
+	Title     string   `json:"title,omitempty"`
+	Body      *string  `json:"body,omitempty"`
+	State     string   `json:"state,omitempty"`
+	Labels    []string `json:"labels,omitempty"`
+	Assignees []string `json:"assignees,omitempty"`
+	Milestone *int     `json:"milestone,omitempty"`
 }
 
 // ------------------------------------------------------------------
@@ -102,26 +41,105 @@ type RepoIssue struct {
 	CreatedAt time.Time `json:"created_at,omitempty"`
 	UpdatedAt time.Time `json:"updated_at,omitempty"`
 	ClosedAt  time.Time `json:"closed_at,omitempty"`
+
+	PullRequest *issuePullRequest `json:"pull_request,omitempty"`
+
+	session *Session
+}
+
+// issuePullRequest is set on issues which are pull requests
+type issuePullRequest struct {
+	URL string `json:"url,omitempty"`
 }
 
 // ------------------------------------------------------------------
 
+func (i *RepoIssue) bind(s *Session) {
+	if i != nil {
+		i.session = s
+	}
+}
+
+// Session returns the session this issue was obtained from
+func (i RepoIssue) Session() *Session {
+	return sessionOrDefault(i.session)
+}
+
+// IsPullRequest tells if the issue is a pull request
+func (i RepoIssue) IsPullRequest() bool {
+	return i.PullRequest != nil
+}
+
 // Comments returns the lists of comments associated with this issue
-func (i RepoIssue) Comments() (*issueCommentsIterator, error) {
+func (i RepoIssue) Comments() (*Iterator[*IssueComment], error) {
 	url := join(i.URL, "comments")
 
-	it := PageIterator(url, HTTPClient())
-	return &issueCommentsIterator{it: it}, nil
+	return newIterator[*IssueComment](i.Session(), url), nil
 }
 
-// PostComment posts a new comment with the given body to the issue
-func (i RepoIssue) PostComment(data map[string]string) (int, error) {
+// PostComment posts a new comment to the issue,
+// returning the comment as created by Github
+func (i RepoIssue) PostComment(data *IssueCommentRequest) (*IssueComment, error) {
 	return i.PostCommentWithContext(context.TODO(), data)
 }
 
-func (i RepoIssue) PostCommentWithContext(ctx context.Context, data map[string]string) (int, error) {
+// PostCommentWithContext posts a new comment to the issue,
+// returning the comment as created by Github
+func (i RepoIssue) PostCommentWithContext(ctx context.Context, data *IssueCommentRequest) (*IssueComment, error) {
+	var comment *IssueComment
 	url := i.toURL("comments")
-	return HTTPClient().PostWithContext(ctx, url, true, data)
+	resp, err := i.Session().client.PostWithContext(ctx, url, true, data)
+	if err := decodeResponse(resp, err, &comment); err != nil {
+		return nil, err
+	}
+
+	comment.bind(i.Session())
+	return comment, nil
+}
+
+// Edit modifies the issue with the given data,
+// returning the issue as updated by Github
+func (i RepoIssue) Edit(data *IssueRequest) (*RepoIssue, error) {
+	return i.EditWithContext(context.TODO(), data)
+}
+
+// EditWithContext modifies the issue with the given data,
+// returning the issue as updated by Github
+func (i RepoIssue) EditWithContext(ctx context.Context, data *IssueRequest) (*RepoIssue, error) {
+	var issue *RepoIssue
+	resp, err := i.Session().client.PatchWithContext(ctx, i.URL, true, data)
+	if err := decodeResponse(resp, err, &issue); err != nil {
+		return nil, err
+	}
+
+	issue.bind(i.Session())
+	return issue, nil
+}
+
+// Lock locks the issue conversation for the given reason
+// ("off-topic", "too heated", "resolved", "spam" or "" for none)
+func (i RepoIssue) Lock(reason string) error {
+	return i.LockWithContext(context.TODO(), reason)
+}
+
+// LockWithContext locks the issue conversation for the given reason
+func (i RepoIssue) LockWithContext(ctx context.Context, reason string) error {
+	data := struct {
+		Reason string `json:"lock_reason,omitempty"`
+	}{reason}
+	_, err := i.Session().client.PutWithContext(ctx, i.toURL("lock"), true, data)
+	return err
+}
+
+// Unlock unlocks the issue conversation
+func (i RepoIssue) Unlock() error {
+	return i.UnlockWithContext(context.TODO())
+}
+
+// UnlockWithContext unlocks the issue conversation
+func (i RepoIssue) UnlockWithContext(ctx context.Context) error {
+	_, err := i.Session().client.DeleteWithContext(ctx, i.toURL("lock"), true, nil)
+	return err
 }
 
 func (i RepoIssue) toURL(suffix ...string) string {
@@ -3,104 +3,81 @@ package object
 import (
 	"context"
 	"fmt"
-	"github.com/brinick/github/client"
+	"time"
 )
 
 // ------------------------------------------------------------------
 
-type issueCommentsIterator struct {
-	Err          error
-	it           client.PageIterator
-	currentPage  []*IssueComment
-	current      *IssueComment
-	currentIndex int
+// IssueCommentRequest holds the fields to set
+// when creating or editing an issue comment
+type IssueCommentRequest struct {
+	Body string `json:"body"`
 }
 
-func (i *issueCommentsIterator) Item() *IssueComment {
-	return i.current
-}
-
-func (i *issueCommentsIterator) HasNext() bool {
-	i.NextWithContext(context.TODO())
-	return i.current != nil
-}
-
-func (i *issueCommentsIterator) HasNextWithContext(ctx context.Context) bool {
-	i.NextWithContext(ctx)
-	return i.current != nil
-}
+// ------------------------------------------------------------------
 
-func (i *issueCommentsIterator) Next() {
-	i.NextWithContext(context.TODO())
+// IssueComment is a comment associated with a given Github issue
+type IssueComment struct {
+	ID        int       `json:"id,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	HTMLURL   string    `json:"html_url,omitempty"`
+	Author    *User     `json:"user,omitempty"`
+	Body      string    `json:"body,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+
+	session *Session
 }
 
-func (i *issueCommentsIterator) NextWithContext(ctx context.Context) {
-	if i.Err != nil {
-		i.current = nil
-		return
-	}
+// ------------------------------------------------------------------
 
-	if i.currentPage == nil || i.currentIndex == len(i.currentPage) {
-		if err := i.load(ctx); err != nil {
-			i.current = nil
-			return
-		}
+func (ic *IssueComment) bind(s *Session) {
+	if ic != nil {
+		ic.session = s
 	}
-
-	i.current = i.currentPage[i.currentIndex]
-	i.currentIndex++
 }
 
-func (i *issueCommentsIterator) load(ctx context.Context) error {
-	var err error
-	i.currentPage, err = i.nextPage(ctx)
-	if err != nil && err != NoMorePages {
-		i.Err = err
-	} else {
-		i.currentIndex = 0
-	}
+// Session returns the session this comment was obtained from
+func (ic IssueComment) Session() *Session {
+	return sessionOrDefault(ic.session)
+}
 
-	return err
+// Update modifies the comment with the given data,
+// returning the comment as updated by Github
+func (ic IssueComment) Update(data *IssueCommentRequest) (*IssueComment, error) {
+	return ic.UpdateWithContext(context.TODO(), data)
 }
 
-func (i *issueCommentsIterator) nextPage(ctx context.Context) ([]*IssueComment, error) {
-	var items []*IssueComment
-	page := i.it.NextWithContext(ctx)
-	if page == nil || page.NoContent() {
-		// page is nil, no results
-		return nil, NoMorePages
-	}
+// UpdateWithContext modifies the comment with the given data,
+// returning the comment as updated by Github
+func (ic IssueComment) UpdateWithContext(ctx context.Context, data *IssueCommentRequest) (*IssueComment, error) {
+	var comment *IssueComment
 
-	if page.Err == nil {
-		parseJSON(page.Content.Data, &items)
+	// the comment URL already ends with its ID
+	resp, err := ic.Session().client.PatchWithContext(ctx, ic.URL, true, data)
+	if err := decodeResponse(resp, err, &comment); err != nil {
+		return nil, err
 	}
 
-	return items, i.it.Error()
+	comment.bind(ic.Session())
+	return comment, nil
 }
 
-// ------------------------------------------------------------------
-
-// IssueComment is a comment associated with a given Github issue
-type IssueComment struct {
-	ID        int
-	URL       string
-	Author    string
-	Body      string
-	CreatedAt int
-	UpdatedAt int
+// Delete deletes the comment
+func (ic IssueComment) Delete() error {
+	return ic.DeleteWithContext(context.TODO())
 }
 
-// ------------------------------------------------------------------
-
-func (ic IssueComment) Update(data map[string]string) (int, error) {
-	return ic.UpdateWithContext(context.TODO(), data)
-}
-
-func (ic IssueComment) UpdateWithContext(ctx context.Context, data map[string]string) (int, error) {
-	url := format("%s/%d", ic.URL, ic.ID)
-	return HTTPClient().PatchWithContext(ctx, url, true, data)
+// DeleteWithContext deletes the comment
+func (ic IssueComment) DeleteWithContext(ctx context.Context) error {
+	_, err := ic.Session().client.DeleteWithContext(ctx, ic.URL, true, nil)
+	return err
 }
 
 func (ic IssueComment) String() string {
-	return fmt.Sprintf("%d: %s", ic.ID, ic.Author)
+	author := NotAvailable
+	if ic.Author != nil {
+		author = ic.Author.Login
+	}
+	return fmt.Sprintf("%d: %s", ic.ID, author)
 }
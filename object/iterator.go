@@ -0,0 +1,375 @@
+package object
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"iter"
+
+	"github.com/brinick/github/client"
+)
+
+// Iterator iterates over the items of multi-page Github results,
+// fetching the pages as needed. Either use it as:
+//
+//	for it.HasNext() {
+//		item := it.Item()
+//		...
+//	}
+//	if it.Err != nil {
+//		...
+//	}
+//
+// or range over it:
+//
+//	for item, err := range it.All() {
+//		if err != nil {
+//			...
+//		}
+//		...
+//	}
+//
+// Iterators left before their last item should be closed, to stop any
+// prefetching of pages (see Session.SetPrefetch). Breaking out of the
+// range loop, First and exhausting a Take do so.
+type Iterator[T any] struct {
+	// Err is the error that stopped the iteration, if any
+	Err error
+
+	src        source[T]
+	current    T
+	hasCurrent bool
+}
+
+// source provides the items of an Iterator one at a time,
+// returning false once there are no more
+type source[T any] interface {
+	next(ctx context.Context) (T, bool, error)
+	cursor() Cursor
+	close()
+}
+
+// binder is implemented by objects carrying the session they came from
+type binder interface {
+	bind(*Session)
+}
+
+// newIterator creates an iterator over the items of the pages of
+// results from the given URL, binding them to the given session
+func newIterator[T any](s *Session, url string) *Iterator[T] {
+	return &Iterator[T]{src: &pager[T]{it: s.pages(url), s: s, pageURL: url}}
+}
+
+// Resume creates an iterator continuing from the given cursor, obtained
+// from an iterator over items of the same type. Items may be skipped or
+// repeated if the results changed in between.
+func Resume[T any](s *Session, c Cursor) *Iterator[T] {
+	s = sessionOrDefault(s)
+	if c.Done {
+		return &Iterator[T]{src: &pager[T]{done: true}}
+	}
+	return &Iterator[T]{
+		src: &pager[T]{it: s.pages(c.PageURL), s: s, pageURL: c.PageURL, skip: c.Offset},
+	}
+}
+
+// Item returns the current item
+func (i *Iterator[T]) Item() T {
+	return i.current
+}
+
+// HasNext moves to the next item, telling if there is one
+func (i *Iterator[T]) HasNext() bool {
+	return i.HasNextWithContext(context.TODO())
+}
+
+// HasNextWithContext moves to the next item, telling if there is one.
+// It returns false, with the iterator Err set, if the context is done.
+func (i *Iterator[T]) HasNextWithContext(ctx context.Context) bool {
+	i.NextWithContext(ctx)
+	return i.hasCurrent
+}
+
+// Next moves to the next item
+func (i *Iterator[T]) Next() {
+	i.NextWithContext(context.TODO())
+}
+
+// NextWithContext moves to the next item
+func (i *Iterator[T]) NextWithContext(ctx context.Context) {
+	var zero T
+	i.current, i.hasCurrent = zero, false
+	if i.Err != nil {
+		return
+	}
+	if err := ctx.Err(); err != nil {
+		i.Err = err
+		return
+	}
+
+	item, ok, err := i.src.next(ctx)
+	if err != nil {
+		i.Err = err
+		return
+	}
+	i.current, i.hasCurrent = item, ok
+}
+
+// All returns the sequence of the remaining items, for use with range.
+// If the iteration fails, the error is yielded last, with a zero item.
+func (i *Iterator[T]) All() iter.Seq2[T, error] {
+	return i.AllWithContext(context.TODO())
+}
+
+// AllWithContext returns the sequence of the remaining items, for use
+// with range. If the iteration fails (e.g. as the context is done),
+// the error is yielded last, with a zero item.
+func (i *Iterator[T]) AllWithContext(ctx context.Context) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for i.HasNextWithContext(ctx) {
+			if !yield(i.Item(), nil) {
+				i.Close()
+				return
+			}
+		}
+		if i.Err != nil {
+			var zero T
+			yield(zero, i.Err)
+		}
+	}
+}
+
+// Collect returns the remaining items
+func (i *Iterator[T]) Collect() ([]T, error) {
+	return i.CollectWithContext(context.TODO())
+}
+
+// CollectWithContext returns the remaining items
+func (i *Iterator[T]) CollectWithContext(ctx context.Context) ([]T, error) {
+	var items []T
+	for i.HasNextWithContext(ctx) {
+		items = append(items, i.Item())
+	}
+	return items, i.Err
+}
+
+// First returns the next item, or NoMorePages if there is none,
+// and closes the iterator
+func (i *Iterator[T]) First() (T, error) {
+	return i.FirstWithContext(context.TODO())
+}
+
+// FirstWithContext returns the next item, or NoMorePages
+// if there is none, and closes the iterator
+func (i *Iterator[T]) FirstWithContext(ctx context.Context) (T, error) {
+	defer i.Close()
+	if i.HasNextWithContext(ctx) {
+		return i.Item(), nil
+	}
+
+	var zero T
+	if i.Err != nil {
+		return zero, i.Err
+	}
+	return zero, NoMorePages
+}
+
+// Close stops fetching pages. The iterator has no next item once closed,
+// though its cursor may still be used to resume the iteration.
+func (i *Iterator[T]) Close() {
+	i.src.close()
+}
+
+// Cursor returns the position of the iterator: resuming from it
+// (see Resume) continues with the item after the current one
+func (i *Iterator[T]) Cursor() Cursor {
+	return i.src.cursor()
+}
+
+// Take returns an iterator over the next n items at most, which is
+// closed once these are iterated over. The iterator it is obtained
+// from should no longer be used.
+func (i *Iterator[T]) Take(n int) *Iterator[T] {
+	return &Iterator[T]{src: &takeSource[T]{src: i.src, n: n}, Err: i.Err}
+}
+
+// Filter returns an iterator over the remaining items
+// for which keep is true. The iterator it is obtained
+// from should no longer be used.
+func (i *Iterator[T]) Filter(keep func(T) bool) *Iterator[T] {
+	return &Iterator[T]{src: &filterSource[T]{src: i.src, keep: keep}, Err: i.Err}
+}
+
+// ------------------------------------------------------------------
+
+// pager is the source of the items of pages of results
+type pager[T any] struct {
+	it      client.PageIterator
+	s       *Session
+	page    []T
+	index   int
+	done    bool
+	closed  bool
+	loaded  bool
+	pageURL string // of the current page, or the first one to load
+	nextURL string
+	skip    int // items of the first page already iterated over
+}
+
+func (p *pager[T]) next(ctx context.Context) (T, bool, error) {
+	var zero T
+	if p.closed {
+		return zero, false, nil
+	}
+	for p.index == len(p.page) {
+		if p.done {
+			return zero, false, nil
+		}
+
+		items, err := p.load(ctx)
+		if err == NoMorePages {
+			p.done = true
+			return zero, false, nil
+		}
+		if err != nil {
+			return zero, false, err
+		}
+		p.page, p.index = items, 0
+		if p.skip > 0 {
+			p.index = min(p.skip, len(items))
+			p.skip = 0
+		}
+	}
+
+	item := p.page[p.index]
+	p.index++
+	return item, true, nil
+}
+
+// load fetches and parses the next page of results
+func (p *pager[T]) load(ctx context.Context) ([]T, error) {
+	page := p.it.NextWithContext(ctx)
+	if page == nil || (page.Err == nil && page.NoContent()) {
+		// no more results
+		return nil, NoMorePages
+	}
+	if page.Err != nil {
+		return nil, page.Err
+	}
+
+	var items []T
+	if err := parseJSON(page.Content.Data, &items); err != nil {
+		return nil, err
+	}
+	p.loaded = true
+	p.pageURL, p.nextURL = page.URL, page.Content.NextLink
+	if p.s != nil {
+		for _, item := range items {
+			if b, ok := interface{}(item).(binder); ok {
+				b.bind(p.s)
+			}
+		}
+	}
+	return items, nil
+}
+
+func (p *pager[T]) close() {
+	if p.closed {
+		return
+	}
+	p.closed = true
+	if c, ok := p.it.(interface{ Close() }); ok {
+		c.Close()
+	}
+}
+
+func (p *pager[T]) cursor() Cursor {
+	switch {
+	case p.done:
+		return Cursor{Done: true}
+	case !p.loaded:
+		return Cursor{PageURL: p.pageURL, Offset: p.skip}
+	case p.index < len(p.page):
+		return Cursor{PageURL: p.pageURL, Offset: p.index}
+	case p.nextURL == "":
+		return Cursor{Done: true}
+	}
+	return Cursor{PageURL: p.nextURL}
+}
+
+// takeSource limits a source to n items
+type takeSource[T any] struct {
+	src source[T]
+	n   int
+}
+
+func (t *takeSource[T]) next(ctx context.Context) (T, bool, error) {
+	if t.n <= 0 {
+		var zero T
+		return zero, false, nil
+	}
+	item, ok, err := t.src.next(ctx)
+	if ok {
+		if t.n--; t.n == 0 {
+			t.src.close()
+		}
+	}
+	return item, ok, err
+}
+
+func (t *takeSource[T]) close() {
+	t.src.close()
+}
+
+func (t *takeSource[T]) cursor() Cursor {
+	return t.src.cursor()
+}
+
+// filterSource skips the items of a source for which keep is false
+type filterSource[T any] struct {
+	src  source[T]
+	keep func(T) bool
+}
+
+func (f *filterSource[T]) next(ctx context.Context) (T, bool, error) {
+	for {
+		item, ok, err := f.src.next(ctx)
+		if !ok || err != nil || f.keep(item) {
+			return item, ok, err
+		}
+	}
+}
+
+func (f *filterSource[T]) close() {
+	f.src.close()
+}
+
+func (f *filterSource[T]) cursor() Cursor {
+	return f.src.cursor()
+}
+
+// ------------------------------------------------------------------
+
+// Cursor is the position of an Iterator, which may be saved (e.g. as
+// JSON, or as a string) so as to resume the iteration later on
+type Cursor struct {
+	PageURL string `json:"page_url,omitempty"`
+	Offset  int    `json:"offset,omitempty"` // within the page
+	Done    bool   `json:"done,omitempty"`
+}
+
+// String encodes the cursor as an opaque string
+func (c Cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor decodes a cursor encoded by Cursor.String
+func ParseCursor(s string) (Cursor, error) {
+	var c Cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	return c, err
+}
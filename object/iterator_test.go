@@ -0,0 +1,194 @@
+package object
+
+import (
+	"context"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brinick/github/client"
+	"github.com/brinick/github/githubtest"
+)
+
+// TestIterator tests ranging over, filtering and limiting iterators
+func TestIterator(t *testing.T) {
+	_, session := newIssuesServer(t)
+	repo := session.Repo("octo", "hello")
+
+	issues, _ := repo.Issues("open", "", "", true)
+	var titles []string
+	for issue, err := range issues.All() {
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		titles = append(titles, issue.Title)
+	}
+	if strings.Join(titles, ",") != "one,two,three,four,five" {
+		t.Errorf("Unexpected issues: %v", titles)
+	}
+
+	issues, _ = repo.Issues("open", "", "", true)
+	withO := issues.Filter(func(i *RepoIssue) bool { return strings.Contains(i.Title, "o") }).Take(3)
+	found, err := withO.Collect()
+	if err != nil || len(found) != 3 || found[2].Title != "four" {
+		t.Errorf("Expected 3 filtered issues, got %v (err: %v)", found, err)
+	}
+
+	issues, _ = repo.Issues("closed", "", "", true)
+	if _, err := issues.First(); err != NoMorePages {
+		t.Errorf("Expected NoMorePages, got %v", err)
+	}
+}
+
+// TestResume tests resuming an iteration from a saved cursor
+func TestResume(t *testing.T) {
+	_, session := newIssuesServer(t)
+	repo := session.Repo("octo", "hello")
+
+	var titles []string
+	issues, _ := repo.Issues("open", "", "", true)
+	cursor := issues.Cursor().String()
+	for {
+		c, err := ParseCursor(cursor)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		issues = Resume[*RepoIssue](session, c)
+		if !issues.HasNext() {
+			break
+		}
+		titles = append(titles, issues.Item().Title)
+		cursor = issues.Cursor().String()
+	}
+	if issues.Err != nil {
+		t.Fatalf("Unexpected error: %v", issues.Err)
+	}
+	if strings.Join(titles, ",") != "one,two,three,four,five" {
+		t.Errorf("Unexpected issues: %v", titles)
+	}
+	if c, _ := ParseCursor(cursor); !c.Done {
+		t.Errorf("Expected a done cursor, got %+v", c)
+	}
+}
+
+// TestIteratorClose tests that iterators left early
+// stop prefetching pages
+func TestIteratorClose(t *testing.T) {
+	srv, _ := newIssuesServer(t)
+	srv.PerPage = 1
+	stalling := &stallingClient{IGithubClient: srv.Client()}
+	session := NewSession(stalling)
+	session.SetPrefetch(2)
+	repo := session.Repo("octo", "hello")
+
+	// leaving once the prefetching requests are made
+	prefetching := func(*RepoIssue) bool {
+		return eventually(func() bool { return stalling.inFlight() > 0 })
+	}
+	leave := map[string]func(*Iterator[*RepoIssue]){
+		"First": func(i *Iterator[*RepoIssue]) { i.Filter(prefetching).First() },
+		"Take":  func(i *Iterator[*RepoIssue]) { i.Filter(prefetching).Take(1).Collect() },
+		"All": func(i *Iterator[*RepoIssue]) {
+			for issue := range i.All() {
+				prefetching(issue)
+				break
+			}
+		},
+	}
+	for name, fn := range leave {
+		issues, _ := repo.Issues("open", "", "", true)
+		fn(issues)
+
+		// the requests are cancelled in the background
+		if !eventually(func() bool { return stalling.inFlight() == 0 }) {
+			t.Errorf("%s: expected the prefetching requests to be cancelled, %d in flight", name, stalling.inFlight())
+		}
+	}
+}
+
+// TestResumeAfterTake tests checkpointing after batches of items
+func TestResumeAfterTake(t *testing.T) {
+	_, session := newIssuesServer(t)
+	issues, _ := session.Repo("octo", "hello").Issues("open", "", "", true)
+
+	var titles []string
+	for {
+		batch, err := issues.Take(3).Collect()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for _, issue := range batch {
+			titles = append(titles, issue.Title)
+		}
+		issues = Resume[*RepoIssue](session, issues.Cursor())
+	}
+	if strings.Join(titles, ",") != "one,two,three,four,five" {
+		t.Errorf("Unexpected issues: %v", titles)
+	}
+}
+
+// ------------------------------------------------------------------
+
+// newIssuesServer returns a fake server with a repository octo/hello
+// of five issues, listed two per page, and a session using it
+func newIssuesServer(t *testing.T) (*githubtest.Server, *Session) {
+	srv := githubtest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.PerPage = 2
+
+	fake := srv.AddRepo("octo", "hello")
+	for _, title := range []string{"one", "two", "three", "four", "five"} {
+		fake.AddIssue(title, "bob")
+	}
+	return srv, NewSession(srv.Client())
+}
+
+// stallingClient holds back the GETs of the pages of results but the
+// first until their context is done, e.g. as their iterator is closed
+type stallingClient struct {
+	client.IGithubClient
+
+	mu       sync.Mutex
+	started  int
+	finished int
+}
+
+func (c *stallingClient) GetWithContext(ctx context.Context, url string, useStableAPI bool) *client.Page {
+	if u, err := neturl.Parse(url); err != nil || u.Query().Get("page") == "" {
+		return c.IGithubClient.GetWithContext(ctx, url, useStableAPI)
+	}
+
+	c.mu.Lock()
+	c.started++
+	c.mu.Unlock()
+
+	<-ctx.Done()
+
+	c.mu.Lock()
+	c.finished++
+	c.mu.Unlock()
+	return &client.Page{URL: url, Err: ctx.Err()}
+}
+
+// inFlight returns the number of GETs still held back
+func (c *stallingClient) inFlight() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.started - c.finished
+}
+
+// eventually tells if the condition is met within a few seconds
+func eventually(cond func() bool) bool {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if cond() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return cond()
+}
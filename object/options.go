@@ -0,0 +1,220 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidOption is returned when listing with invalid options
+var ErrInvalidOption = errors.New("Invalid option")
+
+// ------------------------------------------------------------------
+
+// ListOptions holds the options common to all list endpoints
+type ListOptions struct {
+	// PerPage is the number of items per page of results,
+	// from 1 to 100 (0 for the Github default)
+	PerPage int
+}
+
+func (o ListOptions) encode(v url.Values) error {
+	if o.PerPage < 0 || o.PerPage > 100 {
+		return invalidOption("per_page", strconv.Itoa(o.PerPage))
+	}
+	if o.PerPage > 0 {
+		v.Set("per_page", strconv.Itoa(o.PerPage))
+	}
+	return nil
+}
+
+// PullsOptions holds the options to list pull requests.
+// Empty fields are left to the Github defaults.
+type PullsOptions struct {
+	State     string // "open", "closed" or "all"
+	Head      string // "user:branch"
+	Base      string
+	Sort      string // "created", "updated", "popularity" or "long-running"
+	Direction string // "asc" or "desc"
+	ListOptions
+}
+
+func (o PullsOptions) values() (url.Values, error) {
+	v := url.Values{}
+	if o.State != "" && !isLegalPullRequestState(o.State) {
+		return nil, invalidOption("state", o.State)
+	}
+	if err := oneOf("sort", o.Sort, "created", "updated", "popularity", "long-running"); err != nil {
+		return nil, err
+	}
+	if err := oneOf("direction", o.Direction, "asc", "desc"); err != nil {
+		return nil, err
+	}
+
+	set(v, "state", o.State)
+	set(v, "head", o.Head)
+	set(v, "base", o.Base)
+	set(v, "sort", o.Sort)
+	set(v, "direction", o.Direction)
+	return v, o.ListOptions.encode(v)
+}
+
+// IssuesOptions holds the options to list issues.
+// Empty fields are left to the Github defaults.
+type IssuesOptions struct {
+	State     string // "open", "closed" or "all"
+	Creator   string
+	Assignee  string // a login, "none" or "*" (assigned to anyone)
+	Mentioned string
+	Labels    []string
+	Since     time.Time // only issues updated at or after this time
+	Sort      string    // "created", "updated" or "comments"
+	Direction string    // "asc" or "desc"
+
+	// IncludePRs keeps the issues which are pull requests,
+	// which Github returns along with the others
+	IncludePRs bool
+	ListOptions
+}
+
+func (o IssuesOptions) values() (url.Values, error) {
+	v := url.Values{}
+	if o.State != "" && !isLegalPullRequestState(o.State) {
+		return nil, invalidOption("state", o.State)
+	}
+	if err := oneOf("sort", o.Sort, "created", "updated", "comments"); err != nil {
+		return nil, err
+	}
+	if err := oneOf("direction", o.Direction, "asc", "desc"); err != nil {
+		return nil, err
+	}
+
+	set(v, "state", o.State)
+	set(v, "creator", o.Creator)
+	set(v, "assignee", o.Assignee)
+	set(v, "mentioned", o.Mentioned)
+	set(v, "labels", strings.Join(o.Labels, ","))
+	setTime(v, "since", o.Since)
+	set(v, "sort", o.Sort)
+	set(v, "direction", o.Direction)
+	return v, o.ListOptions.encode(v)
+}
+
+// CommitsOptions holds the options to list commits.
+// Empty fields are left to the Github defaults.
+type CommitsOptions struct {
+	SHA       string // SHA or branch to start from
+	Path      string // only commits touching this file path
+	Author    string // login or email
+	Committer string // login or email
+	Since     time.Time
+	Until     time.Time
+	ListOptions
+}
+
+func (o CommitsOptions) values() (url.Values, error) {
+	v := url.Values{}
+	if !o.Since.IsZero() && !o.Until.IsZero() && o.Until.Before(o.Since) {
+		return nil, invalidOption("until", o.Until.Format(time.RFC3339))
+	}
+
+	set(v, "sha", o.SHA)
+	set(v, "path", o.Path)
+	set(v, "author", o.Author)
+	set(v, "committer", o.Committer)
+	setTime(v, "since", o.Since)
+	setTime(v, "until", o.Until)
+	return v, o.ListOptions.encode(v)
+}
+
+// BranchesOptions holds the options to list branches
+type BranchesOptions struct {
+	// Protected, if set, keeps only protected or unprotected branches
+	Protected *bool
+	ListOptions
+}
+
+func (o BranchesOptions) values() (url.Values, error) {
+	v := url.Values{}
+	if o.Protected != nil {
+		v.Set("protected", strconv.FormatBool(*o.Protected))
+	}
+	return v, o.ListOptions.encode(v)
+}
+
+// TeamsOptions holds the options to list teams
+type TeamsOptions struct {
+	ListOptions
+}
+
+func (o TeamsOptions) values() (url.Values, error) {
+	v := url.Values{}
+	return v, o.ListOptions.encode(v)
+}
+
+// MembersOptions holds the options to list team members
+type MembersOptions struct {
+	Role string // "all", "member" or "maintainer"
+	ListOptions
+}
+
+func (o MembersOptions) values() (url.Values, error) {
+	v := url.Values{}
+	if err := oneOf("role", o.Role, "all", "member", "maintainer"); err != nil {
+		return nil, err
+	}
+
+	set(v, "role", o.Role)
+	return v, o.ListOptions.encode(v)
+}
+
+// ------------------------------------------------------------------
+
+// queryValuer is implemented by the options of list endpoints
+type queryValuer interface {
+	values() (url.Values, error)
+}
+
+// withQuery appends the encoded options to the URL
+func withQuery(url string, opts queryValuer) (string, error) {
+	v, err := opts.values()
+	if err != nil {
+		return "", err
+	}
+	if query := v.Encode(); query != "" {
+		return url + "?" + query, nil
+	}
+	return url, nil
+}
+
+func invalidOption(name, value string) error {
+	return fmt.Errorf("%w: %s=%q", ErrInvalidOption, name, value)
+}
+
+// oneOf checks that the value is empty or one of those legal
+func oneOf(name, value string, legal ...string) error {
+	if value == "" {
+		return nil
+	}
+	for _, l := range legal {
+		if value == l {
+			return nil
+		}
+	}
+	return invalidOption(name, value)
+}
+
+func set(v url.Values, key, value string) {
+	if value != "" {
+		v.Set(key, value)
+	}
+}
+
+func setTime(v url.Values, key string, t time.Time) {
+	if !t.IsZero() {
+		v.Set(key, t.UTC().Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,71 @@
+package object
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/brinick/github/githubtest"
+)
+
+// TestListOptions tests the encoding and validation of list options
+func TestListOptions(t *testing.T) {
+	since := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		opts  queryValuer
+		query string
+	}{
+		{PullsOptions{}, ""},
+		{PullsOptions{State: "all", Head: "me:fix&go", ListOptions: ListOptions{PerPage: 100}},
+			"head=me%3Afix%26go&per_page=100&state=all"},
+		{IssuesOptions{Labels: []string{"bug", "help wanted"}, Since: since},
+			"labels=bug%2Chelp+wanted&since=2020-01-02T03%3A04%3A05Z"},
+		{CommitsOptions{SHA: "main", Path: "a/b.go"}, "path=a%2Fb.go&sha=main"},
+		{MembersOptions{Role: "maintainer"}, "role=maintainer"},
+		{PullsOptions{State: "merged"}, "!"},
+		{IssuesOptions{Sort: "popularity"}, "!"},
+		{TeamsOptions{ListOptions{PerPage: 101}}, "!"},
+		{CommitsOptions{Since: since, Until: since.Add(-time.Hour)}, "!"},
+	}
+
+	for _, test := range tests {
+		url, err := withQuery("u", test.opts)
+		if test.query == "!" {
+			if !errors.Is(err, ErrInvalidOption) {
+				t.Errorf("%+v: expected ErrInvalidOption, got %v", test.opts, err)
+			}
+			continue
+		}
+
+		want := "u"
+		if test.query != "" {
+			want += "?" + test.query
+		}
+		if err != nil || url != want {
+			t.Errorf("%+v: expected %s, got %s (err: %v)", test.opts, want, url, err)
+		}
+	}
+}
+
+// TestIssuesIncludePRs tests that pull requests
+// are only listed as issues if asked to
+func TestIssuesIncludePRs(t *testing.T) {
+	srv := githubtest.NewServer()
+	defer srv.Close()
+
+	fake := srv.AddRepo("octo", "hello")
+	fake.AddIssue("issue", "bob")
+	fake.AddPull("pull", "bob", "main")
+	repo := NewSession(srv.Client()).Repo("octo", "hello")
+
+	for includePRs, want := range map[bool]int{true: 2, false: 1} {
+		issues, err := repo.IssuesWithOptions(&IssuesOptions{State: "all", IncludePRs: includePRs})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		found, err := issues.Collect()
+		if err != nil || len(found) != want {
+			t.Errorf("IncludePRs=%t: expected %d issues, got %d (err: %v)", includePRs, want, len(found), err)
+		}
+	}
+}
@@ -1,9 +1,5 @@
 package object
 
-import (
-	"github.com/brinick/github"
-)
-
 // GithubOrganisation is a Github organisation
 type GithubOrganisation struct {
 	Name        string `json:"name,omitempty"`
@@ -14,24 +10,42 @@ type GithubOrganisation struct {
 	HTMLURL     string `json:"html_url,omitempty"`
 	Company     string `json:"company,omitempty"`
 	NMembers    int    `json:"collaborators,omitempty"`
+
+	session *Session
 }
 
 // Organisation will fetch the GithubOrganisation with the given name
-// or return an error if the organisation can not be found
+// using the default session, or return an error if the organisation
+// can not be found
 func Organisation(name string) (*GithubOrganisation, error) {
-	var org *GithubOrganisation
-	url := join(github.APIURLs.URL, "orgs", name)
-	page := HTTPClient().Get(url, true)
-	if page.Err == nil {
-		parseJSON(page.Content.Data, &org)
+	return DefaultSession().Organisation(name)
+}
+
+func (o *GithubOrganisation) bind(s *Session) {
+	if o != nil {
+		o.session = s
 	}
+}
 
-	return org, page.Err
+// Session returns the session this organisation was obtained from
+func (o GithubOrganisation) Session() *Session {
+	return sessionOrDefault(o.session)
 }
 
 // Teams returns an iterator over the organisation's teams
-func (o GithubOrganisation) Teams() (*teamsIterator, error) {
-	url := join(o.URL, "teams")
-	it := PageIterator(url, HTTPClient())
-	return &teamsIterator{it: it}, nil
+func (o GithubOrganisation) Teams() (*Iterator[*Team], error) {
+	return o.TeamsWithOptions(nil)
+}
+
+// TeamsWithOptions returns an iterator over the organisation's
+// teams with the given options (nil for the Github defaults)
+func (o GithubOrganisation) TeamsWithOptions(opts *TeamsOptions) (*Iterator[*Team], error) {
+	if opts == nil {
+		opts = &TeamsOptions{}
+	}
+	url, err := withQuery(join(o.URL, "teams"), opts)
+	if err != nil {
+		return nil, err
+	}
+	return newIterator[*Team](o.Session(), url), nil
 }
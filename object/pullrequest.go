@@ -2,13 +2,10 @@ package object
 
 import (
 	"context"
-	"fmt"
 	"path/filepath"
 	"time"
 
 	_ "github.com/brinick/logging"
-
-	"github.com/brinick/github/client"
 )
 
 //
@@ -26,89 +23,8 @@ func isLegalPullRequestState(state string) bool {
 
 // ------------------------------------------------------------------
 
-type pullsIterator struct {
-	Err          error
-	it           client.PageIterator
-	currentPage  []*PullRequest
-	current      *PullRequest
-	currentIndex int
-}
-
-func (i *pullsIterator) Item() *PullRequest {
-	return i.current
-}
-
-func (i *pullsIterator) HasNext() bool {
-	i.NextWithContext(context.TODO())
-	return i.current != nil
-}
-
-func (i *pullsIterator) HasNextWithContext(ctx context.Context) bool {
-	i.NextWithContext(ctx)
-	select {
-	case <-ctx.Done():
-		i.Err = ctx.Err()
-		return false
-	default:
-		return i.current != nil
-	}
-}
-
-func (i *pullsIterator) Next() {
-	i.NextWithContext(context.TODO())
-}
-
-func (i *pullsIterator) NextWithContext(ctx context.Context) {
-	if i.Err != nil {
-		i.current = nil
-		return
-	}
-
-	if i.currentPage == nil || i.currentIndex == len(i.currentPage) {
-		if err := i.load(ctx); err != nil {
-			i.current = nil
-			return
-		}
-	}
-
-	i.current = i.currentPage[i.currentIndex]
-	i.currentIndex++
-}
-
-func (i *pullsIterator) load(ctx context.Context) error {
-	var err error
-	i.currentPage, err = i.nextPage(ctx)
-	if err != nil && err != NoMorePages {
-		i.Err = err
-	} else {
-		i.currentIndex = 0
-	}
-
-	return err
-}
-
-func (i *pullsIterator) nextPage(ctx context.Context) ([]*PullRequest, error) {
-	var items []*PullRequest
-	page := i.it.NextWithContext(ctx)
-	if page == nil {
-		// no more data
-		return nil, NoMorePages
-	} else if page.NoContent() {
-		noContent := fmt.Errorf(fmt.Sprintf("No content (status %d)", page.StatusCode))
-		return nil, noContent
-	}
-
-	if page.Err == nil {
-		parseJSON(page.Content.Data, &items)
-	}
-
-	return items, i.it.Error()
-}
-
-// ------------------------------------------------------------------
-
 type PullsGetter interface {
-	Pulls(string, string, string) (*pullsIterator, error)
+	Pulls(string, string, string) (*Iterator[*PullRequest], error)
 	Pull(int) (*PullRequest, error)
 }
 
@@ -132,6 +48,19 @@ type PullRequest struct {
 	ClosedAt  time.Time          `json:"closed_at,omitempty"`
 	Author    *User              `json:"user,omitempty"`
 	Assignee  *User              `json:"assignee,omitempty"`
+
+	session *Session
+}
+
+func (p *PullRequest) bind(s *Session) {
+	if p != nil {
+		p.session = s
+	}
+}
+
+// Session returns the session this pull request was obtained from
+func (p PullRequest) Session() *Session {
+	return sessionOrDefault(p.session)
 }
 
 // IsOpen returns true if the pull request has state "open"
@@ -144,10 +73,9 @@ func (p PullRequest) toURL(suffix ...string) string {
 }
 
 // Commits returns the list of all commits for this pull request
-func (p PullRequest) Commits() (*commitsIterator, error) {
+func (p PullRequest) Commits() (*Iterator[*RepoCommit], error) {
 	url := p.toURL("commits")
-	it := PageIterator(url, HTTPClient())
-	return &commitsIterator{it: it}, nil
+	return newIterator[*RepoCommit](p.Session(), url), nil
 }
 
 func (p PullRequest) HeadCommit() (*RepoCommit, error) {
@@ -170,6 +98,38 @@ func (p PullRequest) HeadCommitWithContext(ctx context.Context) (*RepoCommit, er
 	return commit, commits.Err
 }
 
+// MergeRequest holds the options of a pull request merge.
+// MergeMethod is one of "merge", "squash" or "rebase".
+// If SHA is set, the merge only happens if it matches the head commit.
+type MergeRequest struct {
+	CommitTitle   string `json:"commit_title,omitempty"`
+	CommitMessage string `json:"commit_message,omitempty"`
+	SHA           string `json:"sha,omitempty"`
+	MergeMethod   string `json:"merge_method,omitempty"`
+}
+
+// MergeResult is the outcome of a pull request merge
+type MergeResult struct {
+	SHA     string `json:"sha,omitempty"`
+	Merged  bool   `json:"merged,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Merge merges the pull request
+func (p PullRequest) Merge(data *MergeRequest) (*MergeResult, error) {
+	return p.MergeWithContext(context.TODO(), data)
+}
+
+// MergeWithContext merges the pull request
+func (p PullRequest) MergeWithContext(ctx context.Context, data *MergeRequest) (*MergeResult, error) {
+	var result *MergeResult
+	resp, err := p.Session().client.PutWithContext(ctx, p.toURL("merge"), true, data)
+	if err := decodeResponse(resp, err, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 /*
 // Files retrieves the list of files changed by this pull request
 func (p PullRequest) Files() ([]*CommitFile, error) {
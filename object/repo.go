@@ -2,12 +2,13 @@ package object
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"path/filepath"
 	"strconv"
 	"strings"
 
-	"github.com/brinick/github"
+	"github.com/brinick/github/client"
 )
 
 // ------------------------------------------------------------------
@@ -45,28 +46,35 @@ type Repoer interface {
 
 // Repository is a Github repo
 type Repository struct {
-	owner string
-	name  string
+	owner   string
+	name    string
+	session *Session
 }
 
-// NewRepo creates a new repository instance
+// NewRepo creates a new repository instance bound to the default session
 func NewRepo(owner, name string) *Repository {
-	return &Repository{
-		owner: owner,
-		name:  name,
-	}
+	return DefaultSession().Repo(owner, name)
 }
 
-// NewRepoFromPath creates a Repository object
-// based on the Github path "owner/name"
+// NewRepoFromPath creates a Repository object bound to the default
+// session based on the Github path "owner/name"
 func NewRepoFromPath(path string) *Repository {
+	return DefaultSession().RepoFromPath(path)
+}
+
+// splitRepoPath splits the Github path "owner/name" in its two parts
+func splitRepoPath(path string) (string, string, bool) {
 	tokens := strings.Split(path, "/")
 	if len(tokens) != 2 {
-		return nil
+		return "", "", false
 	}
 
-	owner, name := tokens[0], tokens[1]
-	return NewRepo(owner, name)
+	return tokens[0], tokens[1], true
+}
+
+// Session returns the session this repository is bound to
+func (r Repository) Session() *Session {
+	return sessionOrDefault(r.session)
 }
 
 // Owner returns the owner of this Github repository
@@ -86,7 +94,7 @@ func (r Repository) Path() string {
 
 // FullPath is the full URL to the repository
 func (r Repository) FullPath() string {
-	return format("%s/%s/%s", github.APIURLs.URL, "repos", r.Path())
+	return join(r.Session().BaseURL(), "repos", r.Path())
 }
 
 func (r Repository) toURL(suffix ...string) string {
@@ -95,7 +103,7 @@ func (r Repository) toURL(suffix ...string) string {
 
 // Pulls gets an iterator over the repository's pull requests with
 // given state and author, and in the given branch
-func (r Repository) Pulls(branch, state string) (*pullsIterator, error) {
+func (r Repository) Pulls(branch, state string) (*Iterator[*PullRequest], error) {
 	return r.PullsWithContext(
 		context.TODO(),
 		branch,
@@ -109,11 +117,22 @@ func (r Repository) Pulls(branch, state string) (*pullsIterator, error) {
 func (r Repository) PullsWithContext(
 	ctx context.Context,
 	branch, state string,
-) (*pullsIterator, error) {
+) (*Iterator[*PullRequest], error) {
+
+	return r.PullsWithOptions(&PullsOptions{Base: branch, State: state})
+}
 
-	url := r.toURL(format("pulls?base=%s&state=%s", branch, state))
-	it := PageIterator(url, HTTPClient())
-	return &pullsIterator{it: it}, nil
+// PullsWithOptions gets an iterator over the repository's pull requests
+// selected by the given options (nil for the Github defaults)
+func (r Repository) PullsWithOptions(opts *PullsOptions) (*Iterator[*PullRequest], error) {
+	if opts == nil {
+		opts = &PullsOptions{}
+	}
+	url, err := withQuery(r.toURL("pulls"), opts)
+	if err != nil {
+		return nil, err
+	}
+	return newIterator[*PullRequest](r.Session(), url), nil
 }
 
 // ------------------------------------------------------------------
@@ -122,9 +141,10 @@ func (r Repository) PullsWithContext(
 func (r Repository) Pull(number int) (*PullRequest, error) {
 	var pull *PullRequest
 	url := r.toURL("pulls", strconv.Itoa(number))
-	page := HTTPClient().Get(url, true)
+	page := r.Session().client.Get(url, true)
 	if page.Err == nil {
 		parseJSON(page.Content.Data, &pull)
+		pull.bind(r.Session())
 	}
 	return pull, page.Err
 }
@@ -134,42 +154,84 @@ func (r Repository) Pull(number int) (*PullRequest, error) {
 // a pull request! By default, the Github API will return both.
 // To fetch only issues that are not pull requests, set includePRs to false.
 // To retrieve only unassigned issues, set the assignee to "".
-func (r Repository) Issues(state, author, assignee string, includePRs bool) (*issuesIterator, error) {
-	// TODO: incorporate the includePRs flag in the params
-	params := []string{}
-	params = append(params, format("state=%s", state))
-
+func (r Repository) Issues(state, author, assignee string, includePRs bool) (*Iterator[*RepoIssue], error) {
 	if strings.TrimSpace(assignee) == "" {
 		assignee = "none"
 	}
-	params = append(params, format("assignee=%s", assignee))
+	return r.IssuesWithOptions(&IssuesOptions{
+		State:      state,
+		Creator:    strings.TrimSpace(author),
+		Assignee:   assignee,
+		IncludePRs: includePRs,
+	})
+}
+
+// IssuesWithOptions gets an iterator over the repository's issues
+// selected by the given options (nil for the Github defaults)
+func (r Repository) IssuesWithOptions(opts *IssuesOptions) (*Iterator[*RepoIssue], error) {
+	if opts == nil {
+		opts = &IssuesOptions{}
+	}
+	url, err := withQuery(r.toURL("issues"), opts)
+	if err != nil {
+		return nil, err
+	}
 
-	if strings.TrimSpace(author) != "" {
-		params = append(params, format("creator=%s", author))
+	issues := newIterator[*RepoIssue](r.Session(), url)
+	if !opts.IncludePRs {
+		issues = issues.Filter(func(i *RepoIssue) bool { return !i.IsPullRequest() })
 	}
-	paramsStr := strings.Join(params, "&")
+	return issues, nil
+}
 
-	url := r.toURL(format("issues?%s", paramsStr))
-	it := PageIterator(url, HTTPClient())
-	return &issuesIterator{it: it}, nil
+// CreateIssue opens a new issue in the repository,
+// returning the issue as created by Github
+func (r *Repository) CreateIssue(data *IssueRequest) (*RepoIssue, error) {
+	return r.CreateIssueWithContext(context.TODO(), data)
+}
+
+// CreateIssueWithContext opens a new issue in the repository,
+// returning the issue as created by Github
+func (r *Repository) CreateIssueWithContext(ctx context.Context, data *IssueRequest) (*RepoIssue, error) {
+	var issue *RepoIssue
+	url := r.toURL("issues")
+	resp, err := r.Session().client.PostWithContext(ctx, url, true, data)
+	if err := decodeResponse(resp, err, &issue); err != nil {
+		return nil, err
+	}
+
+	issue.bind(r.Session())
+	return issue, nil
 }
 
 // Issue retrieves the repository issue with the given number
 func (r *Repository) Issue(number int) (*RepoIssue, error) {
 	var issue *RepoIssue
 	url := r.toURL("issues", strconv.Itoa(number))
-	page := HTTPClient().Get(url, true)
+	page := r.Session().client.Get(url, true)
 	if page.Err == nil {
 		parseJSON(page.Content.Data, &issue)
+		issue.bind(r.Session())
 	}
 	return issue, page.Err
 }
 
 // Branches returns an iterator over the branches within the repository
-func (r *Repository) Branches() (*branchesIterator, error) {
-	url := r.toURL("branches")
-	it := PageIterator(url, HTTPClient())
-	return &branchesIterator{it: it}, nil
+func (r *Repository) Branches() (*Iterator[*RepoBranch], error) {
+	return r.BranchesWithOptions(nil)
+}
+
+// BranchesWithOptions returns an iterator over the branches within the
+// repository selected by the given options (nil for the Github defaults)
+func (r *Repository) BranchesWithOptions(opts *BranchesOptions) (*Iterator[*RepoBranch], error) {
+	if opts == nil {
+		opts = &BranchesOptions{}
+	}
+	url, err := withQuery(r.toURL("branches"), opts)
+	if err != nil {
+		return nil, err
+	}
+	return newIterator[*RepoBranch](r.Session(), url), nil
 }
 
 // Branch fetches the branch with the given name
@@ -185,14 +247,16 @@ func (r *Repository) BranchWithContext(
 
 	var b *RepoBranch
 	url := r.toURL("branches", branchName)
-	page := HTTPClient().GetWithContext(ctx, url, true)
+	page := r.Session().client.GetWithContext(ctx, url, true)
 	if page.Err == nil {
 		parseJSON(page.Content.Data, &b)
+		b.bind(r.Session())
 	}
 	return b, page.Err
 }
 
-// BranchExists indicates if a given branch exists
+// BranchExists indicates if a given branch exists.
+// An error is returned only if it could not be determined.
 func (r *Repository) BranchExists(branchName string) (bool, error) {
 	return r.BranchExistsWithContext(context.TODO(), branchName)
 }
@@ -203,6 +267,9 @@ func (r *Repository) BranchExistsWithContext(
 ) (bool, error) {
 
 	if _, err := r.BranchWithContext(ctx, branchName); err != nil {
+		if errors.Is(err, client.ErrNotFound) {
+			return false, nil
+		}
 		return false, err
 	}
 	return true, nil
@@ -211,10 +278,21 @@ func (r *Repository) BranchExistsWithContext(
 // ------------------------------------------------------------------
 
 // Commits gets the list of commits for this branch.
-func (r *Repository) Commits(branchName string) (*commitsIterator, error) {
-	url := r.toURL(format("commits?sha=%s", branchName))
-	it := PageIterator(url, HTTPClient())
-	return &commitsIterator{it: it}, nil
+func (r *Repository) Commits(branchName string) (*Iterator[*RepoCommit], error) {
+	return r.CommitsWithOptions(&CommitsOptions{SHA: branchName})
+}
+
+// CommitsWithOptions gets the list of commits selected
+// by the given options (nil for the Github defaults)
+func (r *Repository) CommitsWithOptions(opts *CommitsOptions) (*Iterator[*RepoCommit], error) {
+	if opts == nil {
+		opts = &CommitsOptions{}
+	}
+	url, err := withQuery(r.toURL("commits"), opts)
+	if err != nil {
+		return nil, err
+	}
+	return newIterator[*RepoCommit](r.Session(), url), nil
 }
 
 // ------------------------------------------------------------------
@@ -223,9 +301,10 @@ func (r *Repository) Commits(branchName string) (*commitsIterator, error) {
 func (r *Repository) Commit(sha string) (*RepoCommit, error) {
 	var commit *RepoCommit
 	url := r.toURL("commits", sha)
-	page := HTTPClient().Get(url, true)
+	page := r.Session().client.Get(url, true)
 	if page.Err == nil {
 		parseJSON(page.Content.Data, &commit)
+		commit.bind(r.Session())
 	}
 	return commit, page.Err
 }
@@ -238,8 +317,81 @@ func (r *Repository) IsCollaborator(login string) bool {
 	// TODO: check permissions or check simply if user is a collaborator?
 	// https://developer.github.com/v3/repos/collaborators/#check-if-a-user-is-a-collaborator
 	url := r.toURL("collaborators", login)
-	page := HTTPClient().Get(url, true)
+	page := r.Session().client.Get(url, true)
 	return page.StatusCode == http.StatusNoContent // 404 = no such user
 }
 
 // ------------------------------------------------------------------
+
+// AddCollaborator invites the user to collaborate on this repository with the
+// given permission ("pull", "triage", "push", "maintain", "admin" or "" for
+// the default)
+func (r *Repository) AddCollaborator(login, permission string) error {
+	return r.AddCollaboratorWithContext(context.TODO(), login, permission)
+}
+
+// AddCollaboratorWithContext invites the user to collaborate
+// on this repository with the given permission
+func (r *Repository) AddCollaboratorWithContext(ctx context.Context, login, permission string) error {
+	data := struct {
+		Permission string `json:"permission,omitempty"`
+	}{permission}
+	url := r.toURL("collaborators", login)
+	_, err := r.Session().client.PutWithContext(ctx, url, true, data)
+	return err
+}
+
+// RemoveCollaborator removes the user from the repository collaborators
+func (r *Repository) RemoveCollaborator(login string) error {
+	return r.RemoveCollaboratorWithContext(context.TODO(), login)
+}
+
+// RemoveCollaboratorWithContext removes the user
+// from the repository collaborators
+func (r *Repository) RemoveCollaboratorWithContext(ctx context.Context, login string) error {
+	url := r.toURL("collaborators", login)
+	_, err := r.Session().client.DeleteWithContext(ctx, url, true, nil)
+	return err
+}
+
+// ------------------------------------------------------------------
+
+// DeleteBranch deletes the branch with the given name
+func (r *Repository) DeleteBranch(branchName string) error {
+	return r.DeleteBranchWithContext(context.TODO(), branchName)
+}
+
+// DeleteBranchWithContext deletes the branch with the given name
+func (r *Repository) DeleteBranchWithContext(ctx context.Context, branchName string) error {
+	url := r.toURL("git/refs/heads", branchName)
+	_, err := r.Session().client.DeleteWithContext(ctx, url, true, nil)
+	return err
+}
+
+// ------------------------------------------------------------------
+
+// Star stars the repository for the authenticated user
+func (r *Repository) Star() error {
+	return r.StarWithContext(context.TODO())
+}
+
+// StarWithContext stars the repository for the authenticated user
+func (r *Repository) StarWithContext(ctx context.Context) error {
+	url := join(r.Session().BaseURL(), "user/starred", r.Path())
+	_, err := r.Session().client.PutWithContext(ctx, url, true, nil)
+	return err
+}
+
+// Unstar unstars the repository for the authenticated user
+func (r *Repository) Unstar() error {
+	return r.UnstarWithContext(context.TODO())
+}
+
+// UnstarWithContext unstars the repository for the authenticated user
+func (r *Repository) UnstarWithContext(ctx context.Context) error {
+	url := join(r.Session().BaseURL(), "user/starred", r.Path())
+	_, err := r.Session().client.DeleteWithContext(ctx, url, true, nil)
+	return err
+}
+
+// ------------------------------------------------------------------
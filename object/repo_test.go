@@ -0,0 +1,128 @@
+package object
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/brinick/github/client"
+	"github.com/brinick/github/client/cachedclient"
+	"github.com/brinick/github/githubtest"
+)
+
+// TestRepoAgainstFakeServer tests the repository objects
+// against the githubtest fake Github server
+func TestRepoAgainstFakeServer(t *testing.T) {
+	srv, s := newIssuesServer(t)
+	head := srv.Repo("octo", "hello").AddCommit("Initial commit", "alice")
+	repo := s.Repo("octo", "hello")
+
+	t.Run("Pagination", func(t *testing.T) {
+		issues, _ := repo.Issues("open", "bob", "", true)
+		n := 0
+		for issues.HasNext() {
+			n++
+		}
+		if issues.Err != nil || n != 5 {
+			t.Errorf("Expected 5 issues, got %d (err: %v)", n, issues.Err)
+		}
+	})
+
+	t.Run("Not modified", func(t *testing.T) {
+		url := repo.toURL("issues", "1")
+		first := s.Client().Get(url, true)
+		second := s.Client().Get(url, true)
+		if second.StatusCode != http.StatusNotModified || second.Content.Data != first.Content.Data {
+			t.Errorf("Expected cached data with status 304, got %d", second.StatusCode)
+		}
+	})
+
+	t.Run("Commit status", func(t *testing.T) {
+		commit, err := repo.Commit(head.SHA)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		status := &CommitStatus{State: "success", Context: "ci"}
+		created, err := commit.SetStatus(status)
+		if err != nil || created.State != "success" || created.Creator == nil {
+			t.Fatalf("Expected the created status, got %v (err: %v)", created, err)
+		}
+		if _, err = commit.SetStatus(status); !errors.Is(err, ErrStatusExists) {
+			t.Errorf("Expected ErrStatusExists, got %v", err)
+		}
+
+		_, err = commit.SetStatus(&CommitStatus{State: "bogus"})
+		var apiErr *client.APIError
+		if !errors.As(err, &apiErr) || !errors.Is(err, client.ErrValidation) || len(apiErr.Errors) != 1 {
+			t.Errorf("Expected a validation error, got %v", err)
+		}
+	})
+
+	t.Run("Comments", func(t *testing.T) {
+		issue, err := repo.Issue(1)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		comment, err := issue.PostComment(&IssueCommentRequest{Body: "hi"})
+		if err != nil || comment.ID == 0 || comment.Author == nil || comment.Author.Login != "octo" ||
+			comment.CreatedAt.IsZero() {
+			t.Fatalf("Expected the created comment, got %+v (err: %v)", comment, err)
+		}
+
+		updated, err := comment.Update(&IssueCommentRequest{Body: "edited"})
+		if err != nil || updated.Body != "edited" || updated.Author == nil ||
+			!updated.CreatedAt.Equal(comment.CreatedAt) || updated.UpdatedAt.Before(comment.CreatedAt) {
+			t.Errorf("Expected the updated comment, got %+v (err: %v)", updated, err)
+		}
+	})
+
+	t.Run("Transient failure", func(t *testing.T) {
+		srv.InjectFault(githubtest.Fault{Method: "GET", StatusCode: http.StatusBadGateway, Times: 1})
+		if _, err := repo.Issue(2); err != nil {
+			t.Errorf("Expected the request to be retried, got %v", err)
+		}
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		exists, err := repo.BranchExists("nope")
+		if exists || err != nil {
+			t.Errorf("Expected inexistant branch, got %t (err: %v)", exists, err)
+		}
+	})
+}
+
+// TestTeamAgainstFakeServer tests that changing the members of a team,
+// at the URL given by Github, makes the cached list of members stale
+func TestTeamAgainstFakeServer(t *testing.T) {
+	srv := githubtest.NewServer()
+	defer srv.Close()
+
+	fake := srv.AddOrg("octo-org")
+	fake.AddMember(fake.AddTeam("devs", "Developers"), "alice", "member")
+
+	c := srv.Client()
+	org, err := NewSession(c).Organisation("octo-org")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	teams, _ := org.Teams()
+	team, err := teams.First()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	members, _ := team.Members()
+	if found, err := members.Collect(); err != nil || len(found) != 1 {
+		t.Fatalf("Expected 1 member, got %d (err: %v)", len(found), err)
+	}
+	if err := team.AddMember("bob", "member"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	c.SetNetworkMode(cachedclient.Offline)
+	members, _ = team.Members()
+	if _, err := members.Collect(); !errors.Is(err, client.ErrOffline) {
+		t.Errorf("Expected the cached members to be invalidated, got %v", err)
+	}
+}
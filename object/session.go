@@ -0,0 +1,130 @@
+package object
+
+import (
+	"sync"
+
+	"github.com/brinick/github/client"
+	"github.com/brinick/github/client/cachedclient"
+)
+
+// ------------------------------------------------------------------
+
+var (
+	defaultSession   *Session
+	defaultSessionMu sync.Mutex
+)
+
+// DefaultSession returns the session used by objects that were not
+// obtained from an explicit Session (e.g. via NewRepo or Organisation).
+// It is lazily created with a cached client configured from the
+// environment (see cachedclient.NewClient).
+func DefaultSession() *Session {
+	defaultSessionMu.Lock()
+	defer defaultSessionMu.Unlock()
+
+	if defaultSession == nil {
+		defaultSession = NewSession(cachedclient.NewClient())
+	}
+	return defaultSession
+}
+
+// SetDefaultSession replaces the session returned by DefaultSession
+func SetDefaultSession(s *Session) {
+	defaultSessionMu.Lock()
+	defer defaultSessionMu.Unlock()
+	defaultSession = s
+}
+
+// ------------------------------------------------------------------
+
+// Session owns the Github client (and thus the transport, token and cache)
+// used to talk to the API. Repositories, organisations, teams etc. obtained
+// from a session carry it with them, as does anything fetched from them.
+type Session struct {
+	client   client.IGithubClient
+	prefetch int
+}
+
+// NewSession creates a new session using the given Github client
+func NewSession(c client.IGithubClient) *Session {
+	return &Session{client: c}
+}
+
+// Client returns the Github client of this session
+func (s *Session) Client() client.IGithubClient {
+	return s.client
+}
+
+// SetPrefetch makes the iterators over multi-page results fetch pages
+// with the given number of concurrent requests (see
+// client.PrefetchPageIterator). One or less fetches a page at a time,
+// which is the default. It should be called before using the session.
+func (s *Session) SetPrefetch(workers int) {
+	s.prefetch = workers
+}
+
+// pages returns an iterator over the pages of results from the given URL
+func (s *Session) pages(url string) client.PageIterator {
+	if s.prefetch > 1 {
+		return client.NewPrefetchPageIterator(url, s.client, s.prefetch)
+	}
+	return PageIterator(url, s.client)
+}
+
+// BaseURL returns the REST API base URL of this session's client
+func (s *Session) BaseURL() string {
+	return s.client.Endpoints().URL
+}
+
+// Repo creates a new repository instance bound to this session
+func (s *Session) Repo(owner, name string) *Repository {
+	return &Repository{
+		owner:   owner,
+		name:    name,
+		session: s,
+	}
+}
+
+// RepoFromPath creates a Repository object bound to this session
+// based on the Github path "owner/name"
+func (s *Session) RepoFromPath(path string) *Repository {
+	owner, name, ok := splitRepoPath(path)
+	if !ok {
+		return nil
+	}
+	return s.Repo(owner, name)
+}
+
+// Organisation will fetch the GithubOrganisation with the given name
+// or return an error if the organisation can not be found
+func (s *Session) Organisation(name string) (*GithubOrganisation, error) {
+	var org *GithubOrganisation
+	url := join(s.BaseURL(), "orgs", name)
+	page := s.client.Get(url, true)
+	if page.Err == nil {
+		parseJSON(page.Content.Data, &org)
+		org.bind(s)
+	}
+
+	return org, page.Err
+}
+
+// Team creates a new team instance bound to this session
+func (s *Session) Team(id int, name string) *Team {
+	return &Team{
+		ID:      id,
+		Name:    name,
+		session: s,
+	}
+}
+
+// ------------------------------------------------------------------
+
+// sessionOrDefault returns the given session, or
+// the default one if the former is nil
+func sessionOrDefault(s *Session) *Session {
+	if s == nil {
+		return DefaultSession()
+	}
+	return s
+}
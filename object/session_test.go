@@ -0,0 +1,125 @@
+package object
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/brinick/github"
+	"github.com/brinick/github/client"
+)
+
+type fakeClient struct {
+	pages     map[string]string
+	responses map[string]string // to writes, instead of echoing them
+	urls      []string
+}
+
+func (f *fakeClient) Endpoints() github.API {
+	return github.APIURLs
+}
+
+func (f *fakeClient) Get(url string, useStableAPI bool) *client.Page {
+	return f.GetWithContext(context.TODO(), url, useStableAPI)
+}
+
+func (f *fakeClient) GetWithContext(ctx context.Context, url string, useStableAPI bool) *client.Page {
+	f.urls = append(f.urls, url)
+	data, found := f.pages[url]
+	if !found {
+		return &client.Page{URL: url, StatusCode: http.StatusNotFound, Err: client.ErrNotFound}
+	}
+	return &client.Page{URL: url, StatusCode: http.StatusOK, Content: &client.Payload{Data: data}}
+}
+
+func (f *fakeClient) Post(url string, useStableAPI bool, data interface{}) (*client.Response, error) {
+	return f.PostWithContext(context.TODO(), url, useStableAPI, data)
+}
+
+func (f *fakeClient) PostWithContext(ctx context.Context, url string, useStableAPI bool, data interface{}) (*client.Response, error) {
+	f.urls = append(f.urls, url)
+	if response, found := f.responses[url]; found {
+		return &client.Response{StatusCode: http.StatusCreated, Body: []byte(response)}, nil
+	}
+	body, _ := json.Marshal(data)
+	return &client.Response{StatusCode: http.StatusCreated, Body: body}, nil
+}
+
+func (f *fakeClient) Put(url string, useStableAPI bool, data interface{}) (*client.Response, error) {
+	return f.PatchWithContext(context.TODO(), url, useStableAPI, data)
+}
+
+func (f *fakeClient) PutWithContext(ctx context.Context, url string, useStableAPI bool, data interface{}) (*client.Response, error) {
+	return f.PatchWithContext(ctx, url, useStableAPI, data)
+}
+
+func (f *fakeClient) Delete(url string, useStableAPI bool, data interface{}) (*client.Response, error) {
+	return f.PatchWithContext(context.TODO(), url, useStableAPI, data)
+}
+
+func (f *fakeClient) DeleteWithContext(ctx context.Context, url string, useStableAPI bool, data interface{}) (*client.Response, error) {
+	return f.PatchWithContext(ctx, url, useStableAPI, data)
+}
+
+func (f *fakeClient) Patch(url string, useStableAPI bool, data interface{}) (*client.Response, error) {
+	return f.PatchWithContext(context.TODO(), url, useStableAPI, data)
+}
+
+func (f *fakeClient) PatchWithContext(ctx context.Context, url string, useStableAPI bool, data interface{}) (*client.Response, error) {
+	f.urls = append(f.urls, url)
+	return &client.Response{StatusCode: http.StatusOK, Body: []byte(`{}`)}, nil
+}
+
+// ------------------------------------------------------------------
+
+// TestSessionBinding tests that objects fetched via a session
+// carry that session, and use its client for subsequent calls
+func TestSessionBinding(t *testing.T) {
+	base := "https://api.github.com/repos/octo/hello"
+	fake := &fakeClient{
+		pages: map[string]string{
+			base + "/issues/3": `{"number": 3, "url": "` + base + `/issues/3"}`,
+		},
+		responses: map[string]string{
+			base + "/issues/3/comments": `{
+				"id": 7, "url": "` + base + `/issues/comments/7", "body": "hi",
+				"user": {"login": "alice", "id": 1},
+				"created_at": "2024-01-02T03:04:05Z", "updated_at": "2024-01-02T03:04:05Z"
+			}`,
+		},
+	}
+	s := NewSession(fake)
+
+	issue, err := s.Repo("octo", "hello").Issue(3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if issue.Session() != s {
+		t.Errorf("Expected issue bound to the session")
+	}
+
+	comment, err := issue.PostComment(&IssueCommentRequest{Body: "hi"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if comment.Body != "hi" || comment.Session() != s {
+		t.Errorf("Expected decoded comment bound to the session, got %v", comment)
+	}
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if comment.ID != 7 || comment.Author == nil || comment.Author.Login != "alice" ||
+		!comment.CreatedAt.Equal(created) || !comment.UpdatedAt.Equal(created) {
+		t.Errorf("Expected the comment fields to be decoded, got %+v", comment)
+	}
+
+	expected := []string{base + "/issues/3", base + "/issues/3/comments"}
+	if len(fake.urls) != len(expected) {
+		t.Fatalf("Expected calls %v, got %v", expected, fake.urls)
+	}
+	for i, url := range expected {
+		if fake.urls[i] != url {
+			t.Errorf("Expected %v, got %v", url, fake.urls[i])
+		}
+	}
+}
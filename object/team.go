@@ -3,84 +3,10 @@ package object
 import (
 	"context"
 	"fmt"
-
-	"github.com/brinick/github/client"
 )
 
 // ------------------------------------------------------------------
 
-type teamsIterator struct {
-	Err          error
-	it           client.PageIterator
-	currentPage  []*Team
-	current      *Team
-	currentIndex int
-}
-
-func (i *teamsIterator) Item() *Team {
-	return i.current
-}
-
-func (i *teamsIterator) HasNext() bool {
-	i.NextWithContext(context.TODO())
-	return i.current != nil
-}
-
-func (i *teamsIterator) HasNextWithContext(ctx context.Context) bool {
-	i.NextWithContext(ctx)
-	return i.current != nil
-}
-
-func (i *teamsIterator) Next() {
-	i.NextWithContext(context.TODO())
-}
-
-func (i *teamsIterator) NextWithContext(ctx context.Context) {
-	if i.Err != nil {
-		i.current = nil
-		return
-	}
-
-	if i.currentPage == nil || i.currentIndex == len(i.currentPage) {
-		if err := i.load(ctx); err != nil {
-			i.current = nil
-			return
-		}
-	}
-
-	i.current = i.currentPage[i.currentIndex]
-	i.currentIndex++
-}
-
-func (i *teamsIterator) load(ctx context.Context) error {
-	var err error
-	i.currentPage, err = i.nextPage(ctx)
-	if err != nil && err != NoMorePages {
-		i.Err = err
-	} else {
-		i.currentIndex = 0
-	}
-
-	return err
-}
-
-func (i *teamsIterator) nextPage(ctx context.Context) ([]*Team, error) {
-	var items []*Team
-	page := i.it.NextWithContext(ctx)
-	if page == nil || page.NoContent() {
-		// page is nil, no results
-		return nil, NoMorePages
-	}
-
-	if page.Err == nil {
-		parseJSON(page.Content.Data, &items)
-	}
-
-	return items, i.it.Error()
-}
-
-// ------------------------------------------------------------------
-
 // Team is a Github team of people
 type Team struct {
 	ID          int                `json:"id,omitempty"`
@@ -92,32 +18,83 @@ type Team struct {
 	NRepos      int                `json:"repos_count,omitempty"`
 	Org         GithubOrganisation `json:"organization,omitempty"`
 	Parent      *Team              `json:"parent,omitempty"`
+
+	session *Session
 }
 
 // ------------------------------------------------------------------
 
-// NewTeam creates a new team instance
+// NewTeam creates a new team instance bound to the default session
 func NewTeam(id int, name string) *Team {
-	return &Team{
-		ID:   id,
-		Name: name,
+	return DefaultSession().Team(id, name)
+}
+
+func (t *Team) bind(s *Session) {
+	if t != nil {
+		t.session = s
+		t.Org.bind(s)
+		t.Parent.bind(s)
 	}
 }
 
+// Session returns the session this team was obtained from
+func (t Team) Session() *Session {
+	return sessionOrDefault(t.session)
+}
+
 // Members will fetch an iterator over the members of a Github team
-func (t Team) Members() (*teamMembersIterator, error) {
-	url := join(t.URL, "members")
-	it := PageIterator(url, HTTPClient())
-	return &teamMembersIterator{it: it}, nil
+func (t Team) Members() (*Iterator[*TeamMember], error) {
+	return t.MembersWithOptions(nil)
+}
+
+// MembersWithOptions will fetch an iterator over the members of a Github
+// team selected by the given options (nil for the Github defaults)
+func (t Team) MembersWithOptions(opts *MembersOptions) (*Iterator[*TeamMember], error) {
+	if opts == nil {
+		opts = &MembersOptions{}
+	}
+	url, err := withQuery(join(t.URL, "members"), opts)
+	if err != nil {
+		return nil, err
+	}
+	return newIterator[*TeamMember](t.Session(), url), nil
 }
 
 // IsMember checks for a particular user's membership of a team
 func (t Team) IsMember(login string) (bool, error) {
 	url := join(t.URL, "memberships", login)
-	page := HTTPClient().Get(url, true)
+	page := t.Session().client.Get(url, true)
 	return page.StatusCode == 200, page.Err
 }
 
+// AddMember adds the user as a team member with
+// the given role ("member" or "maintainer")
+func (t Team) AddMember(login, role string) error {
+	return t.AddMemberWithContext(context.TODO(), login, role)
+}
+
+// AddMemberWithContext adds the user as a team member with the given role
+func (t Team) AddMemberWithContext(ctx context.Context, login, role string) error {
+	data := struct {
+		Role string `json:"role,omitempty"`
+	}{role}
+	url := join(t.URL, "memberships", login)
+	_, err := t.Session().client.PutWithContext(ctx, url, true, data)
+	return err
+}
+
+// RemoveMember removes the user from the team
+func (t Team) RemoveMember(login string) error {
+	return t.RemoveMemberWithContext(context.TODO(), login)
+}
+
+// RemoveMemberWithContext removes the user from the team
+func (t Team) RemoveMemberWithContext(ctx context.Context, login string) error {
+	url := join(t.URL, "memberships", login)
+	_, err := t.Session().client.DeleteWithContext(ctx, url, true, nil)
+	return err
+}
+
 func (t Team) String() string {
 	return fmt.Sprintf("%s(%d)", t.Name, t.ID)
 }